@@ -5,9 +5,11 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"tcgcli/tcg"
 )
@@ -27,12 +29,21 @@ const (
 
 type DeckManager struct {
 	DecksDir    string
+	Catalog     *tcg.Catalog
 	CurrentDeck *tcg.Deck
 }
 
 func main() {
 	reader := bufio.NewReader(os.Stdin)
-	manager, err := NewDeckManager("decks")
+	catalog, err := tcg.LoadCatalog()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%sFailed to load card data: %v%s\n", colorRed, err, colorReset)
+		os.Exit(1)
+	}
+	reportCatalog(catalog)
+	catalog = catalog.WithLocale(tcg.LocaleFromEnv())
+
+	manager, err := NewDeckManager("decks", catalog)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%sFailed to initialize deck manager: %v%s\n", colorRed, err, colorReset)
 		os.Exit(1)
@@ -48,12 +59,12 @@ func main() {
 	}
 }
 
-func NewDeckManager(decksDir string) (*DeckManager, error) {
-	return &DeckManager{DecksDir: decksDir}, nil
+func NewDeckManager(decksDir string, catalog *tcg.Catalog) (*DeckManager, error) {
+	return &DeckManager{DecksDir: decksDir, Catalog: catalog}, nil
 }
 
 func (m *DeckManager) ListExistingDecks() ([]string, error) {
-	manager, err := tcg.NewDeckManager(m.DecksDir)
+	manager, err := tcg.NewDeckManager(m.DecksDir, m.Catalog)
 	if err != nil {
 		return nil, err
 	}
@@ -70,7 +81,7 @@ func (m *DeckManager) CreateNewDeck(reader *bufio.Reader) error {
 		return nil
 	}
 
-	manager, err := tcg.NewDeckManager(m.DecksDir)
+	manager, err := tcg.NewDeckManager(m.DecksDir, m.Catalog)
 	if err != nil {
 		return err
 	}
@@ -79,24 +90,37 @@ func (m *DeckManager) CreateNewDeck(reader *bufio.Reader) error {
 		fmt.Printf("%sA deck with that name already exists.%s\n", colorRed, colorReset)
 		return nil
 	}
+	if errors.Is(err, tcg.ErrDeckLocked) {
+		fmt.Printf("%sDeck '%s' is being edited elsewhere. Close it there and try again.%s\n", colorRed, deckName, colorReset)
+		return nil
+	}
+	if errors.Is(err, tcg.ErrInvalidDeckName) {
+		fmt.Printf("%s%v%s\n", colorRed, err, colorReset)
+		return nil
+	}
 	if err != nil {
 		return err
 	}
 
 	fmt.Printf("%sNew deck '%s' created.%s\n", colorGreen, deckName, colorReset)
 	m.handleDeckLoadMessages(deck)
+	// Save takes the lock again, so the web UI can use the deck meanwhile.
+	deck.Close()
+	resolveLegacyEntries(reader, deck)
 	m.CurrentDeck = deck
 	return nil
 }
 
-func (m *DeckManager) LoadExistingDeck(reader *bufio.Reader) error {
+// chooseDeck lists the saved decks and asks for one by number. It returns an
+// empty name when there is nothing to pick or the selection is invalid.
+func (m *DeckManager) chooseDeck(reader *bufio.Reader, action string) (string, error) {
 	decks, err := m.ListExistingDecks()
 	if err != nil {
-		return err
+		return "", err
 	}
 	if len(decks) == 0 {
 		fmt.Printf("%sNo saved decks found.%s\n", colorYellow, colorReset)
-		return nil
+		return "", nil
 	}
 
 	fmt.Printf("%s\nExisting decks:%s\n", colorCyan, colorReset)
@@ -104,28 +128,41 @@ func (m *DeckManager) LoadExistingDeck(reader *bufio.Reader) error {
 		fmt.Printf("%s  %d. %s%s\n", colorCyan, idx+1, deckName, colorReset)
 	}
 
-	choiceStr, err := prompt(reader, fmt.Sprintf("%sEnter the number of the deck to load: %s", colorWhite, colorReset))
+	choiceStr, err := prompt(reader, fmt.Sprintf("%sEnter the number of the deck to %s: %s", colorWhite, action, colorReset))
 	if err != nil {
-		return err
+		return "", err
 	}
 	choice, err := strconv.Atoi(choiceStr)
 	if err != nil || choice < 1 || choice > len(decks) {
 		fmt.Printf("%sInvalid selection.%s\n", colorRed, colorReset)
-		return nil
+		return "", nil
 	}
+	return decks[choice-1], nil
+}
 
-	selectedDeck := decks[choice-1]
-	manager, err := tcg.NewDeckManager(m.DecksDir)
+func (m *DeckManager) LoadExistingDeck(reader *bufio.Reader) error {
+	selectedDeck, err := m.chooseDeck(reader, "load")
+	if err != nil || selectedDeck == "" {
+		return err
+	}
+	manager, err := tcg.NewDeckManager(m.DecksDir, m.Catalog)
 	if err != nil {
 		return err
 	}
 	deck, err := manager.LoadDeck(selectedDeck)
+	if errors.Is(err, tcg.ErrDeckLocked) {
+		fmt.Printf("%sDeck '%s' is being edited elsewhere. Close it there and try again.%s\n", colorRed, selectedDeck, colorReset)
+		return nil
+	}
 	if err != nil {
 		return err
 	}
 
 	fmt.Printf("%sDeck '%s' loaded.%s\n", colorGreen, selectedDeck, colorReset)
 	m.handleDeckLoadMessages(deck)
+	// Save takes the lock again, so the web UI can use the deck meanwhile.
+	deck.Close()
+	resolveLegacyEntries(reader, deck)
 	m.CurrentDeck = deck
 	return nil
 }
@@ -135,9 +172,14 @@ func (m *DeckManager) SelectDeck(reader *bufio.Reader) error {
 		fmt.Printf("%s\nDeck Manager Options:%s\n", colorMagenta, colorReset)
 		fmt.Println("  1: Create a new deck")
 		fmt.Println("  2: Load an existing deck")
-		fmt.Println("  3: Exit")
+		fmt.Println("  3: Rename a deck")
+		fmt.Println("  4: Duplicate a deck")
+		fmt.Println("  5: Archive a deck")
+		fmt.Println("  6: Delete a deck")
+		fmt.Println("  7: Merge opponent archetypes")
+		fmt.Println("  8: Exit")
 
-		choice, err := prompt(reader, fmt.Sprintf("%sEnter your choice (1-3): %s", colorWhite, colorReset))
+		choice, err := prompt(reader, fmt.Sprintf("%sEnter your choice (1-8): %s", colorWhite, colorReset))
 		if err != nil {
 			return err
 		}
@@ -158,6 +200,26 @@ func (m *DeckManager) SelectDeck(reader *bufio.Reader) error {
 				return nil
 			}
 		case "3":
+			if err := m.RenameDeck(reader); err != nil {
+				return err
+			}
+		case "4":
+			if err := m.DuplicateDeck(reader); err != nil {
+				return err
+			}
+		case "5":
+			if err := m.ArchiveDeck(reader); err != nil {
+				return err
+			}
+		case "6":
+			if err := m.DeleteDeck(reader); err != nil {
+				return err
+			}
+		case "7":
+			if err := m.MergeArchetypes(reader); err != nil {
+				return err
+			}
+		case "8":
 			fmt.Printf("%sGoodbye!%s\n", colorGreen, colorReset)
 			return nil
 		default:
@@ -166,6 +228,172 @@ func (m *DeckManager) SelectDeck(reader *bufio.Reader) error {
 	}
 }
 
+func (m *DeckManager) RenameDeck(reader *bufio.Reader) error {
+	deckName, err := m.chooseDeck(reader, "rename")
+	if err != nil || deckName == "" {
+		return err
+	}
+	newName, err := prompt(reader, fmt.Sprintf("%sEnter the new name: %s", colorWhite, colorReset))
+	if err != nil {
+		return err
+	}
+
+	manager, err := tcg.NewDeckManager(m.DecksDir, m.Catalog)
+	if err != nil {
+		return err
+	}
+	deck, err := manager.RenameDeck(deckName, newName)
+	if reportDeckOpError(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	deck.Close()
+	fmt.Printf("%sDeck '%s' renamed to '%s'.%s\n", colorGreen, deckName, deck.Name, colorReset)
+	return nil
+}
+
+func (m *DeckManager) DuplicateDeck(reader *bufio.Reader) error {
+	deckName, err := m.chooseDeck(reader, "duplicate")
+	if err != nil || deckName == "" {
+		return err
+	}
+	newName, err := prompt(reader, fmt.Sprintf("%sEnter a name for the copy: %s", colorWhite, colorReset))
+	if err != nil {
+		return err
+	}
+	answer, err := prompt(reader, fmt.Sprintf("%sCopy the battle history too? (y/N): %s", colorWhite, colorReset))
+	if err != nil {
+		return err
+	}
+
+	manager, err := tcg.NewDeckManager(m.DecksDir, m.Catalog)
+	if err != nil {
+		return err
+	}
+	deck, err := manager.DuplicateDeck(deckName, newName, strings.EqualFold(answer, "y"))
+	if reportDeckOpError(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	deck.Close()
+	fmt.Printf("%sDeck '%s' copied to '%s'.%s\n", colorGreen, deckName, deck.Name, colorReset)
+	return nil
+}
+
+func (m *DeckManager) ArchiveDeck(reader *bufio.Reader) error {
+	deckName, err := m.chooseDeck(reader, "archive")
+	if err != nil || deckName == "" {
+		return err
+	}
+
+	manager, err := tcg.NewDeckManager(m.DecksDir, m.Catalog)
+	if err != nil {
+		return err
+	}
+	if err := manager.ArchiveDeck(deckName); reportDeckOpError(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	fmt.Printf("%sDeck '%s' moved to %s.%s\n", colorGreen, deckName, filepath.Join(m.DecksDir, tcg.ArchiveDirName), colorReset)
+	return nil
+}
+
+func (m *DeckManager) DeleteDeck(reader *bufio.Reader) error {
+	deckName, err := m.chooseDeck(reader, "delete")
+	if err != nil || deckName == "" {
+		return err
+	}
+	answer, err := prompt(reader, fmt.Sprintf("%sDelete '%s'? (y/N): %s", colorWhite, deckName, colorReset))
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(answer, "y") {
+		return nil
+	}
+
+	manager, err := tcg.NewDeckManager(m.DecksDir, m.Catalog)
+	if err != nil {
+		return err
+	}
+	if err := manager.DeleteDeck(deckName); reportDeckOpError(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	fmt.Printf("%sDeck '%s' moved to the trash folder %s.%s\n", colorGreen, deckName, filepath.Join(m.DecksDir, tcg.TrashDirName), colorReset)
+	return nil
+}
+
+func (m *DeckManager) MergeArchetypes(reader *bufio.Reader) error {
+	manager, err := tcg.NewDeckManager(m.DecksDir, m.Catalog)
+	if err != nil {
+		return err
+	}
+	archetypes := manager.Archetypes.List()
+	if len(archetypes) > 0 {
+		fmt.Printf("%s\nKnown archetypes:%s\n", colorCyan, colorReset)
+		for idx, archetype := range archetypes {
+			fmt.Printf("%s  %d. %s%s", colorCyan, idx+1, archetype.Name, colorReset)
+			if len(archetype.Aliases) > 0 {
+				fmt.Printf(" (also: %s)", strings.Join(archetype.Aliases, ", "))
+			}
+			fmt.Println()
+		}
+	}
+	pick := func(message string) (string, error) {
+		value, err := prompt(reader, fmt.Sprintf("%s%s (number or name): %s", colorWhite, message, colorReset))
+		if err != nil {
+			return "", err
+		}
+		if choice, err := strconv.Atoi(value); err == nil && choice >= 1 && choice <= len(archetypes) {
+			return archetypes[choice-1].Name, nil
+		}
+		return value, nil
+	}
+
+	from, err := pick("Archetype to merge away")
+	if err != nil || from == "" {
+		return err
+	}
+	into, err := pick(fmt.Sprintf("Merge '%s' into", from))
+	if err != nil || into == "" {
+		return err
+	}
+
+	changed, err := manager.MergeArchetypes(from, into)
+	if reportDeckOpError(err) {
+		return nil
+	}
+	if err != nil {
+		fmt.Printf("%sMerge failed: %v%s\n", colorRed, err, colorReset)
+		return nil
+	}
+	fmt.Printf("%s'%s' merged into '%s'; %d battle(s) updated.%s\n", colorGreen, from, manager.Archetypes.Normalize(into), changed, colorReset)
+	return nil
+}
+
+// reportDeckOpError prints errors the user can fix and reports whether it did.
+func reportDeckOpError(err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, os.ErrExist):
+		fmt.Printf("%sA deck with that name already exists.%s\n", colorRed, colorReset)
+	case errors.Is(err, tcg.ErrDeckLocked):
+		fmt.Printf("%sThat deck is being edited elsewhere. Close it there and try again.%s\n", colorRed, colorReset)
+	case errors.Is(err, tcg.ErrInvalidDeckName), errors.Is(err, tcg.ErrUnconfirmedOverwrite), errors.Is(err, os.ErrNotExist):
+		fmt.Printf("%s%v%s\n", colorRed, err, colorReset)
+	default:
+		return false
+	}
+	return true
+}
+
 func mainMenu(reader *bufio.Reader, deck *tcg.Deck) {
 	for {
 		fmt.Printf("%s\nMain Menu:%s\n", colorMagenta, colorReset)
@@ -175,9 +403,13 @@ func mainMenu(reader *bufio.Reader, deck *tcg.Deck) {
 		fmt.Println("  3: Remove a card from your deck")
 		fmt.Println("  4: Record a battle outcome")
 		fmt.Println("  5: Show deck battle statistics")
-		fmt.Println("  6: Save and exit")
+		fmt.Println("  6: List card sets")
+		fmt.Println("  7: Choose deck format")
+		fmt.Println("  8: Set energy types")
+		fmt.Println("  9: Edit battle history")
+		fmt.Println(" 10: Save and exit")
 
-		choice, err := prompt(reader, fmt.Sprintf("%sEnter your choice (0-6): %s", colorWhite, colorReset))
+		choice, err := prompt(reader, fmt.Sprintf("%sEnter your choice (0-10): %s", colorWhite, colorReset))
 		if err != nil {
 			fmt.Printf("%sError reading input: %v%s\n", colorRed, err, colorReset)
 			continue
@@ -303,9 +535,45 @@ func mainMenu(reader *bufio.Reader, deck *tcg.Deck) {
 				}
 			}
 		case "5":
-			showStatistics(deck)
+			query, ok := askStatsQuery(reader)
+			if ok {
+				showStatistics(deck, query)
+			}
 		case "6":
-			if err := deck.Save(); err != nil {
+			listSets(reader, deck)
+		case "7":
+			chooseFormat(reader, deck)
+		case "8":
+			setEnergyTypes(reader, deck)
+		case "9":
+			editBattleHistory(reader, deck)
+		case "10":
+			err := deck.Save()
+			if errors.Is(err, tcg.ErrUnconfirmedOverwrite) {
+				fmt.Printf("%sSaving will replace %s, which could not be read when the deck was loaded.%s\n", colorYellow, deck.FilePath, colorReset)
+				answer, promptErr := prompt(reader, fmt.Sprintf("%sOverwrite it with the recovered deck? (y/N): %s", colorWhite, colorReset))
+				if promptErr != nil || !strings.EqualFold(answer, "y") {
+					fmt.Printf("%sDeck not saved. The file was left untouched.%s\n", colorYellow, colorReset)
+					continue
+				}
+				deck.ConfirmOverwrite()
+				err = deck.Save()
+			}
+			if errors.Is(err, tcg.ErrDeckLocked) {
+				fmt.Printf("%sDeck '%s' is being saved elsewhere. Try again in a moment.%s\n", colorYellow, deck.Name, colorReset)
+				continue
+			}
+			if errors.Is(err, tcg.ErrDeckChanged) {
+				fmt.Printf("%s%s was changed elsewhere, for example in the web UI, since this deck was loaded.%s\n", colorYellow, deck.FilePath, colorReset)
+				answer, promptErr := prompt(reader, fmt.Sprintf("%sOverwrite those changes with this deck? (y/N): %s", colorWhite, colorReset))
+				if promptErr != nil || !strings.EqualFold(answer, "y") {
+					fmt.Printf("%sDeck not saved. Your changes are still open here.%s\n", colorYellow, colorReset)
+					continue
+				}
+				deck.ConfirmOverwrite()
+				err = deck.Save()
+			}
+			if err != nil {
 				fmt.Printf("%sFailed to save deck: %v%s\n", colorRed, err, colorReset)
 			} else {
 				fmt.Printf("%sDeck '%s' saved successfully!%s\n", colorGreen, deck.Name, colorReset)
@@ -386,16 +654,16 @@ func addCard(reader *bufio.Reader, deck *tcg.Deck, searchTerm string) {
 	cardSet := formatForDisplay(result.Card.Set)
 
 	if !result.Added {
-		if result.TotalCopies >= 2 {
-			fmt.Printf("%sWarning: Already have 2 copies of %s (across all sets). Cannot add more.%s\n", colorYellow, cardName, colorReset)
+		if result.TotalCopies >= result.Limit {
+			fmt.Printf("%sWarning: Already have %d copies of %s (across all sets). Cannot add more.%s\n", colorYellow, result.TotalCopies, cardName, colorReset)
 			return
 		}
-		fmt.Printf("%sWarning: Already have 2 copies of %s from %s.%s\n", colorYellow, cardName, cardSet, colorReset)
+		fmt.Printf("%sWarning: Already have %d copies of %s from %s.%s\n", colorYellow, result.SetCopies, cardName, cardSet, colorReset)
 		return
 	}
 
-	if result.SetCopies == 2 {
-		fmt.Printf("%s%s from %s added. You now have 2 copies in this set.%s\n", colorGreen, cardName, cardSet, colorReset)
+	if result.SetCopies == result.Limit && result.SetCopies > 1 {
+		fmt.Printf("%s%s from %s added. You now have %d copies in this set.%s\n", colorGreen, cardName, cardSet, result.SetCopies, colorReset)
 	} else if result.SetCopies == 1 && result.TotalCopies == 1 {
 		fmt.Printf("%s%s from %s added to your deck.%s\n", colorGreen, cardName, cardSet, colorReset)
 	} else {
@@ -403,15 +671,138 @@ func addCard(reader *bufio.Reader, deck *tcg.Deck, searchTerm string) {
 	}
 }
 
+func listSets(reader *bufio.Reader, deck *tcg.Deck) {
+	sets := deck.Catalog.Sets()
+	if len(sets) == 0 {
+		fmt.Printf("%sNo card sets available.%s\n", colorRed, colorReset)
+		return
+	}
+
+	fmt.Printf("%s\nCard Sets:%s\n", colorCyan, colorReset)
+	for _, set := range sets {
+		released := ""
+		if set.ReleaseDate != "" {
+			released = fmt.Sprintf(", released %s", set.ReleaseDate)
+		}
+		packs := ""
+		if len(set.Packs) > 0 {
+			packs = fmt.Sprintf(", packs: %s", strings.Join(set.Packs, ", "))
+		}
+		fmt.Printf(" - %s (%s): %d cards%s%s\n", formatForDisplay(set.Name), set.Code, set.CardCount, released, packs)
+	}
+
+	code, err := prompt(reader, fmt.Sprintf("%s\nEnter a set code to list its cards (or press Enter to go back): %s", colorMagenta, colorReset))
+	if err != nil || code == "" {
+		return
+	}
+	set, ok := deck.Catalog.FindSet(code)
+	if !ok {
+		fmt.Printf("%sUnknown set code '%s'.%s\n", colorRed, code, colorReset)
+		return
+	}
+	fmt.Printf("%s\nCards in %s (%s):%s\n", colorCyan, set.Name, set.Code, colorReset)
+	for _, card := range deck.Catalog.FindBySet(set.Code) {
+		fmt.Printf(" - %s (ID: %s)\n", formatForDisplay(card.Name), card.ID)
+	}
+}
+
 func viewDeck(deck *tcg.Deck) {
+	fmt.Printf("%s\nDeck: %s (format: %s, energy: %s)%s\n", colorLightCyan, deck.Name, deck.ActiveFormat().Name, joinEnergy(deck.EnergyTypes), colorReset)
 	if len(deck.Cards) == 0 {
 		fmt.Printf("%sYour deck is empty.%s\n", colorYellow, colorReset)
+	}
+	for idx, entry := range deck.DisplayCards() {
+		fmt.Printf("%s  %d. %s x %d from %s%s\n", colorLightCyan, idx+1, entry.Name, entry.Count, entry.Set, colorReset)
+	}
+	printValidation(deck.Validate())
+}
+
+func chooseFormat(reader *bufio.Reader, deck *tcg.Deck) {
+	formats := deck.Formats.List()
+	current := deck.ActiveFormat().Name
+	fmt.Printf("%s\nFormats:%s\n", colorCyan, colorReset)
+	for idx, format := range formats {
+		marker := ""
+		if format.Name == current {
+			marker = " (current)"
+		}
+		fmt.Printf("  %d. %s%s", idx+1, format.Name, marker)
+		if format.Description != "" {
+			fmt.Printf(" - %s", format.Description)
+		}
+		fmt.Println()
+	}
+
+	choiceStr, err := prompt(reader, fmt.Sprintf("%sEnter the number of the format: %s", colorWhite, colorReset))
+	if err != nil {
+		return
+	}
+	choice, err := strconv.Atoi(choiceStr)
+	if err != nil || choice < 1 || choice > len(formats) {
+		fmt.Printf("%sInvalid selection.%s\n", colorRed, colorReset)
+		return
+	}
+	if err := deck.SetFormat(formats[choice-1].Name); err != nil {
+		fmt.Printf("%sFailed to set format: %v%s\n", colorRed, err, colorReset)
 		return
 	}
+	fmt.Printf("%sDeck '%s' now uses the %s format.%s\n", colorGreen, deck.Name, deck.ActiveFormat().Name, colorReset)
+	printValidation(deck.Validate())
+}
 
-	fmt.Printf("%s\nDeck: %s%s\n", colorLightCyan, deck.Name, colorReset)
-	for idx, entry := range deck.Cards {
-		fmt.Printf("%s  %d. %s x %d from %s%s\n", colorLightCyan, idx+1, entry.Name, entry.Count, entry.Set, colorReset)
+func setEnergyTypes(reader *bufio.Reader, deck *tcg.Deck) {
+	if len(deck.EnergyTypes) > 0 {
+		fmt.Printf("%sCurrent energy types: %s%s\n", colorCyan, joinEnergy(deck.EnergyTypes), colorReset)
+	}
+	suggested := deck.SuggestEnergyTypes()
+	message := "Enter up to 3 energy types separated by commas: "
+	if len(suggested) > 0 {
+		message = fmt.Sprintf("Enter up to 3 energy types separated by commas (press Enter for %s): ", joinEnergy(suggested))
+	}
+	input, err := prompt(reader, colorWhite+message+colorReset)
+	if err != nil {
+		return
+	}
+
+	types := suggested
+	if input != "" {
+		types, err = tcg.ParseEnergyTypes(input)
+		if err != nil {
+			fmt.Printf("%s%v%s\n", colorRed, err, colorReset)
+			return
+		}
+	}
+	if err := deck.SetEnergyTypes(types); err != nil {
+		fmt.Printf("%s%v%s\n", colorRed, err, colorReset)
+		return
+	}
+	fmt.Printf("%sEnergy types set to %s.%s\n", colorGreen, joinEnergy(deck.EnergyTypes), colorReset)
+	printValidation(deck.Validate())
+}
+
+func joinEnergy(types []tcg.EnergyType) string {
+	if len(types) == 0 {
+		return "none"
+	}
+	names := make([]string, len(types))
+	for idx, energy := range types {
+		names[idx] = string(energy)
+	}
+	return strings.Join(names, ", ")
+}
+
+func printValidation(validation tcg.DeckValidation) {
+	if validation.Legal {
+		fmt.Printf("%s\n[LEGAL]%s\n", colorGreen, colorReset)
+	} else {
+		fmt.Printf("%s\n[NOT LEGAL]%s\n", colorRed, colorReset)
+	}
+	for _, issue := range validation.Issues {
+		color := colorYellow
+		if issue.Severity == tcg.IssueError {
+			color = colorRed
+		}
+		fmt.Printf("%s  %s: %s%s\n", color, issue.Severity, issue.Message, colorReset)
 	}
 }
 
@@ -429,62 +820,484 @@ func removeCard(deck *tcg.Deck, index int) {
 }
 
 func recordBattle(reader *bufio.Reader, deck *tcg.Deck) {
-	outcome, err := prompt(reader, fmt.Sprintf("%sEnter battle outcome (W for win, L for loss): %s", colorWhite, colorReset))
-	if err != nil {
+	ask := func(message string) (string, bool) {
+		value, err := prompt(reader, fmt.Sprintf("%s%s: %s", colorWhite, message, colorReset))
+		return value, err == nil
+	}
+	askNumber := func(message string) (int, bool) {
+		value, ok := ask(message)
+		if !ok || value == "" {
+			return 0, ok
+		}
+		number, err := strconv.Atoi(value)
+		if err != nil || number < 0 {
+			fmt.Printf("%sPlease enter a whole number.%s\n", colorRed, colorReset)
+			return 0, false
+		}
+		return number, true
+	}
+
+	var record tcg.BattleRecord
+	var ok bool
+	outcome, ok := ask("Enter battle outcome (W for win, L for loss, T for tie)")
+	if !ok {
 		return
 	}
-	opponent, err := prompt(reader, fmt.Sprintf("%sEnter opponent deck details (or other metadata): %s", colorWhite, colorReset))
-	if err != nil {
+	record.Result = tcg.Outcome(outcome)
+	if record.Opponent, ok = ask("Opponent deck archetype"); !ok {
+		return
+	}
+	record.Opponent = completeArchetype(reader, deck.Archetypes, record.Opponent)
+	fmt.Printf("%sThe remaining details are optional; press Enter to skip.%s\n", colorCyan, colorReset)
+	reasons := make([]string, len(tcg.OutcomeReasons))
+	for idx, reason := range tcg.OutcomeReasons {
+		reasons[idx] = strings.ReplaceAll(string(reason), "_", " ")
+	}
+	reason, ok := ask(fmt.Sprintf("How did it end? (%s)", strings.Join(reasons, ", ")))
+	if !ok {
 		return
 	}
-	if err := deck.RecordBattle(outcome, opponent, time.Now()); err != nil {
-		fmt.Printf("%sInvalid outcome. Use 'W' or 'L'.%s\n", colorRed, colorReset)
+	record.Reason = tcg.OutcomeReason(reason)
+	if record.OpponentPlayer, ok = ask("Opponent player name"); !ok {
+		return
+	}
+	turnOrder, ok := ask("Did you go first or second? (1/2)")
+	if !ok {
+		return
+	}
+	record.TurnOrder = tcg.TurnOrder(turnOrder)
+	if record.Points, ok = askNumber("Your final points"); !ok {
+		return
+	}
+	if record.OpponentPoints, ok = askNumber("Opponent's final points"); !ok {
+		return
+	}
+	if record.Turns, ok = askNumber("Turns taken"); !ok {
+		return
+	}
+	mode, ok := ask("Game mode (ranked, casual or event)")
+	if !ok {
+		return
+	}
+	record.Mode = tcg.GameMode(mode)
+	if record.Notes, ok = ask("Notes"); !ok {
+		return
+	}
+	tags, ok := ask("Tags (comma separated)")
+	if !ok {
+		return
+	}
+	record.Tags = tcg.ParseTags(tags)
+
+	if err := deck.RecordBattle(record, time.Now()); err != nil {
+		fmt.Printf("%sBattle not recorded: %v%s\n", colorRed, err, colorReset)
 		return
 	}
 	fmt.Printf("%sBattle record added for deck '%s'.%s\n", colorGreen, deck.Name, colorReset)
 }
 
-func showStatistics(deck *tcg.Deck) {
-	stats := deck.Stats()
+func editBattleHistory(reader *bufio.Reader, deck *tcg.Deck) {
+	for {
+		if len(deck.BattleHistory) == 0 {
+			fmt.Printf("%sNo battle records yet.%s\n", colorYellow, colorReset)
+			return
+		}
+		fmt.Printf("%s\nBattle History for '%s':%s\n", colorCyan, deck.Name, colorReset)
+		for idx, battle := range deck.BattleHistory {
+			fmt.Printf("  %d. %s\n", idx+1, describeBattle(battle))
+		}
+
+		choiceStr, err := prompt(reader, fmt.Sprintf("%sEnter the number of the battle to change (Enter to go back): %s", colorWhite, colorReset))
+		if err != nil || choiceStr == "" {
+			return
+		}
+		choice, err := strconv.Atoi(choiceStr)
+		if err != nil || choice < 1 || choice > len(deck.BattleHistory) {
+			fmt.Printf("%sInvalid selection.%s\n", colorRed, colorReset)
+			continue
+		}
+		battle := deck.BattleHistory[choice-1]
+
+		action, err := prompt(reader, fmt.Sprintf("%sEdit or delete this battle? (edit/delete): %s", colorWhite, colorReset))
+		if err != nil {
+			return
+		}
+		switch strings.ToLower(action) {
+		case "edit", "e":
+			editBattle(reader, deck, battle)
+		case "delete", "d":
+			confirm, err := prompt(reader, fmt.Sprintf("%sDelete '%s'? (y/N): %s", colorWhite, describeBattle(battle), colorReset))
+			if err != nil || !strings.EqualFold(confirm, "y") {
+				fmt.Printf("%sBattle kept.%s\n", colorYellow, colorReset)
+				continue
+			}
+			if _, err := deck.DeleteBattle(battle.ID); err != nil {
+				fmt.Printf("%sBattle not deleted: %v%s\n", colorRed, err, colorReset)
+				continue
+			}
+			fmt.Printf("%sBattle deleted.%s\n", colorGreen, colorReset)
+		default:
+			fmt.Printf("%sInvalid choice.%s\n", colorRed, colorReset)
+		}
+	}
+}
+
+// editBattle prompts for every field of battle, showing the current value;
+// Enter keeps it and "-" clears it.
+func editBattle(reader *bufio.Reader, deck *tcg.Deck, battle tcg.BattleRecord) {
+	edit := func(message, current string) (string, bool) {
+		value, err := prompt(reader, fmt.Sprintf("%s%s [%s]: %s", colorWhite, message, current, colorReset))
+		switch {
+		case err != nil:
+			return current, false
+		case value == "":
+			return current, true
+		case value == "-":
+			return "", true
+		}
+		return value, true
+	}
+	editNumber := func(message string, current int) (int, bool) {
+		value, ok := edit(message, strconv.Itoa(current))
+		if !ok || value == "" {
+			return 0, ok
+		}
+		number, err := strconv.Atoi(value)
+		if err != nil || number < 0 {
+			fmt.Printf("%sPlease enter a whole number.%s\n", colorRed, colorReset)
+			return 0, false
+		}
+		return number, true
+	}
+
+	fmt.Printf("%sPress Enter to keep a value, or enter - to clear it.%s\n", colorCyan, colorReset)
+	record := battle
+	var value string
+	var ok bool
+	if value, ok = edit("Outcome (W, L or T)", string(record.Result)); !ok {
+		return
+	}
+	record.Result = tcg.Outcome(value)
+	if value, ok = edit("How did it end", string(record.Reason)); !ok {
+		return
+	}
+	record.Reason = tcg.OutcomeReason(value)
+	if value, ok = edit("Opponent deck archetype", record.Opponent); !ok {
+		return
+	}
+	if value != record.Opponent {
+		value = completeArchetype(reader, deck.Archetypes, value)
+	}
+	record.Opponent = value
+	if record.OpponentPlayer, ok = edit("Opponent player name", record.OpponentPlayer); !ok {
+		return
+	}
+	if value, ok = edit("Turn order (first or second)", string(record.TurnOrder)); !ok {
+		return
+	}
+	record.TurnOrder = tcg.TurnOrder(value)
+	if record.Points, ok = editNumber("Your final points", record.Points); !ok {
+		return
+	}
+	if record.OpponentPoints, ok = editNumber("Opponent's final points", record.OpponentPoints); !ok {
+		return
+	}
+	if record.Turns, ok = editNumber("Turns taken", record.Turns); !ok {
+		return
+	}
+	if value, ok = edit("Game mode (ranked, casual or event)", string(record.Mode)); !ok {
+		return
+	}
+	record.Mode = tcg.GameMode(value)
+	if record.Format, ok = edit("Format", record.Format); !ok {
+		return
+	}
+	if record.Notes, ok = edit("Notes", record.Notes); !ok {
+		return
+	}
+	if value, ok = edit("Tags (comma separated)", strings.Join(record.Tags, ", ")); !ok {
+		return
+	}
+	record.Tags = tcg.ParseTags(value)
+
+	if err := deck.UpdateBattle(battle.ID, record); err != nil {
+		fmt.Printf("%sBattle not updated: %v%s\n", colorRed, err, colorReset)
+		return
+	}
+	fmt.Printf("%sBattle updated.%s\n", colorGreen, colorReset)
+}
+
+func describeBattle(battle tcg.BattleRecord) string {
+	var date string
+	if !battle.Date.IsZero() {
+		date = battle.Date.In(tcg.DisplayTimeZone()).Format("2006-01-02 15:04") + "  "
+	}
+	description := fmt.Sprintf("%s%s vs %s", date, battle.Result, battle.Opponent)
+	if battle.Reason != "" {
+		description += " (" + battle.Reason.Describe(battle.Result) + ")"
+	}
+	if battle.Notes != "" {
+		description += " — " + battle.Notes
+	}
+	return description
+}
+
+// completeArchetype offers known archetypes matching a partial or unknown
+// opponent name, keeping the input when none is picked.
+func completeArchetype(reader *bufio.Reader, registry *tcg.ArchetypeRegistry, input string) string {
+	if input == "" {
+		return input
+	}
+	if archetype, ok := registry.Find(input); ok {
+		return archetype.Name
+	}
+	suggestions := registry.Suggest(input, 5)
+	if len(suggestions) == 0 {
+		return input
+	}
+	fmt.Printf("%sKnown archetypes matching '%s':%s\n", colorCyan, input, colorReset)
+	for idx, name := range suggestions {
+		fmt.Printf("  %d. %s\n", idx+1, name)
+	}
+	choiceStr, err := prompt(reader, fmt.Sprintf("%sPick a number, or press Enter to keep '%s': %s", colorWhite, input, colorReset))
+	if err != nil || choiceStr == "" {
+		return input
+	}
+	choice, err := strconv.Atoi(choiceStr)
+	if err != nil || choice < 1 || choice > len(suggestions) {
+		return input
+	}
+	return suggestions[choice-1]
+}
+
+// askStatsQuery offers to narrow the statistics to a time window or a
+// subset of games. It reports false if the input was invalid.
+func askStatsQuery(reader *bufio.Reader) (tcg.StatsQuery, bool) {
+	var query tcg.StatsQuery
+	answer, err := prompt(reader, fmt.Sprintf("%sFilter the statistics? (y/N): %s", colorWhite, colorReset))
+	if err != nil || !strings.EqualFold(answer, "y") {
+		return query, err == nil
+	}
+	ask := func(message string) (string, bool) {
+		value, err := prompt(reader, fmt.Sprintf("%s%s: %s", colorWhite, message, colorReset))
+		return value, err == nil
+	}
+	fail := func(err error) (tcg.StatsQuery, bool) {
+		fmt.Printf("%s%v%s\n", colorRed, err, colorReset)
+		return query, false
+	}
+
+	fmt.Printf("%sPress Enter to skip a filter.%s\n", colorCyan, colorReset)
+	location := tcg.DisplayTimeZone()
+	for _, bound := range []struct {
+		message string
+		target  *time.Time
+	}{
+		{"Since (YYYY-MM-DD, or 30d for the last 30 days)", &query.Since},
+		{"Until, exclusive (YYYY-MM-DD)", &query.Until},
+	} {
+		value, ok := ask(bound.message)
+		if !ok {
+			return query, false
+		}
+		if *bound.target, err = tcg.ParseStatsDate(value, time.Now(), location); err != nil {
+			return fail(err)
+		}
+	}
+	value, ok := ask("Only the last N games")
+	if !ok {
+		return query, false
+	}
+	if value != "" {
+		if query.Last, err = strconv.Atoi(value); err != nil || query.Last < 0 {
+			return fail(fmt.Errorf("please enter a whole number"))
+		}
+	}
+	if value, ok = ask("Game mode (ranked, casual or event)"); !ok {
+		return query, false
+	}
+	if query.Mode, err = tcg.ParseGameMode(value); err != nil {
+		return fail(err)
+	}
+	if value, ok = ask("Turn order (first or second)"); !ok {
+		return query, false
+	}
+	if query.TurnOrder, err = tcg.ParseTurnOrder(value); err != nil {
+		return fail(err)
+	}
+	if query.Opponent, ok = ask("Opponent deck archetype"); !ok {
+		return query, false
+	}
+	if value, ok = ask("Tags, all required (comma separated)"); !ok {
+		return query, false
+	}
+	query.Tags = tcg.ParseTags(value)
+	return query, true
+}
+
+func showStatistics(deck *tcg.Deck, query tcg.StatsQuery) {
+	stats := deck.StatsFor(query, tcg.DefaultStatsOptions())
+	filter := query.Describe(tcg.DisplayTimeZone())
 	if stats.TotalBattles == 0 {
+		if filter != "" {
+			fmt.Printf("%sNo battles match the filter (%s).%s\n", colorYellow, filter, colorReset)
+			return
+		}
 		fmt.Printf("%sNo battle records to show statistics.%s\n", colorYellow, colorReset)
 		return
 	}
 
-	fmt.Printf("%s\nBattle Statistics for '%s':%s\n", colorCyan, deck.Name, colorReset)
+	if filter != "" {
+		fmt.Printf("%s\nBattle Statistics for '%s' (%s):%s\n", colorCyan, deck.Name, filter, colorReset)
+	} else {
+		fmt.Printf("%s\nBattle Statistics for '%s':%s\n", colorCyan, deck.Name, colorReset)
+	}
 	fmt.Printf("%s  Total Battles: %d%s\n", colorCyan, stats.TotalBattles, colorReset)
 	fmt.Printf("%s  Wins: %d%s\n", colorCyan, stats.Wins, colorReset)
 	fmt.Printf("%s  Losses: %d%s\n", colorCyan, stats.Losses, colorReset)
-	fmt.Printf("%s  Win Percentage: %.2f%%%s\n", colorCyan, stats.WinPercentage, colorReset)
+	fmt.Printf("%s  Ties: %d%s\n", colorCyan, stats.Ties, colorReset)
+	fmt.Printf("%s  Win Rate: %s, 95%% interval (%s)%s\n", colorCyan, stats.WinRate, describeTieHandling(stats.TieHandling), colorReset)
+	if posterior := stats.WinRate.Posterior; posterior != nil {
+		fmt.Printf("%s  Bayesian Estimate: %.0f%% (%.0f–%.0f%%)%s\n", colorCyan, posterior.Mean, posterior.Low, posterior.High, colorReset)
+	}
+	if stats.WinRate.SmallSample {
+		fmt.Printf("%s  Only %d game(s) so far; the true win rate could be anywhere in that range.%s\n", colorYellow, stats.WinRate.Games, colorReset)
+	}
 
 	fmt.Printf("%s\nWin/Loss Graph:%s\n", colorBlue, colorReset)
 	fmt.Printf("%sWins  : %s%s\n", colorGreen, strings.Repeat("*", stats.Wins), colorReset)
 	fmt.Printf("%sLosses: %s%s\n", colorRed, strings.Repeat("*", stats.Losses), colorReset)
+	if stats.Ties > 0 {
+		fmt.Printf("%sTies  : %s%s\n", colorYellow, strings.Repeat("*", stats.Ties), colorReset)
+	}
+
+	if len(stats.Reasons) > 0 {
+		fmt.Printf("%s\nHow Games Ended:%s\n", colorBlue, colorReset)
+		for _, outcome := range []tcg.Outcome{tcg.OutcomeWin, tcg.OutcomeLoss, tcg.OutcomeTie} {
+			for _, reason := range tcg.OutcomeReasons {
+				if count := stats.Reasons[outcome][reason]; count > 0 {
+					fmt.Printf("%s  %s, %s: %d%s\n", colorBlue, outcome, reason.Describe(outcome), count, colorReset)
+				}
+			}
+		}
+	}
+
+	if len(stats.Daily) > 0 {
+		days := stats.Daily
+		if len(days) > 7 {
+			days = days[len(days)-7:]
+		}
+		fmt.Printf("%s\nRecent Days (%s):%s\n", colorBlue, stats.TimeZone, colorReset)
+		for _, day := range days {
+			fmt.Printf("%s  %s: %dW %dL %dT%s\n", colorBlue, day.Date, day.Wins, day.Losses, day.Ties, colorReset)
+		}
+	}
 
-	if len(stats.LossByOpponent) > 0 {
-		fmt.Printf("%s\nLoss Frequency by Opponent Deck:%s\n", colorLightMagenta, colorReset)
-		for opponent, count := range stats.LossByOpponent {
-			fmt.Printf("%s  %s: %d loss(es)%s\n", colorLightMagenta, opponent, count, colorReset)
+	fmt.Printf("%s\nMatchups (opponents with at least %d game(s)):%s\n", colorLightMagenta, stats.MatchupMinGames, colorReset)
+	if len(stats.Matchups) == 0 {
+		fmt.Printf("%s  No opponent has been played often enough yet.%s\n", colorLightMagenta, colorReset)
+	}
+	width := 0
+	for _, matchup := range stats.Matchups {
+		width = max(width, utf8.RuneCountInString(matchup.Opponent))
+	}
+	smallSamples := false
+	for _, matchup := range stats.Matchups {
+		flag := ""
+		if matchup.WinRate.SmallSample {
+			flag = " *"
+			smallSamples = true
 		}
+		record := fmt.Sprintf("%dW %dL %dT", matchup.Wins, matchup.Losses, matchup.Ties)
+		fmt.Printf("%s  %-*s  %3d game(s)  %-11s  %s%s%s\n", colorLightMagenta, width, matchup.Opponent, matchup.Games, record, matchup.WinRate, flag, colorReset)
+	}
+	if smallSamples {
+		fmt.Printf("%s  * small sample; treat the win rate as a rough guide.%s\n", colorYellow, colorReset)
+	}
+	if stats.HiddenMatchups > 0 {
+		fmt.Printf("%s  %d opponent(s) with fewer games not shown.%s\n", colorLightMagenta, stats.HiddenMatchups, colorReset)
 	}
 }
 
-func (m *DeckManager) handleDeckLoadMessages(deck *tcg.Deck) {
-	switch deck.CardsSource {
+func describeTieHandling(handling tcg.TieHandling) string {
+	switch handling {
+	case tcg.TiesAsHalf:
+		return "ties count as half a win"
+	case tcg.TiesAsLosses:
+		return "ties count as games not won"
+	}
+	return "ties excluded"
+}
+
+func reportCatalog(catalog *tcg.Catalog) {
+	switch catalog.Source {
 	case tcg.CardsSourceRemote:
-		fmt.Printf("%sLoaded latest card data from online database.%s\n", colorGreen, colorReset)
+		fmt.Printf("%sLoaded latest card data from %s.%s\n", colorGreen, catalog.Origin, colorReset)
+	case tcg.CardsSourceCache:
+		if catalog.Warning != nil {
+			fmt.Printf("%sWarning: Could not refresh card data (%v). Using cached catalog.%s\n", colorYellow, catalog.Warning, colorReset)
+		}
 	case tcg.CardsSourceLocal:
-		if deck.CardsLoadError != nil {
-			fmt.Printf("%sWarning: Could not fetch latest card data (%v). Using local cache.%s\n", colorYellow, deck.CardsLoadError, colorReset)
+		if catalog.Warning != nil {
+			fmt.Printf("%sWarning: Could not fetch latest card data (%v). Using %s.%s\n", colorYellow, catalog.Warning, catalog.Origin, colorReset)
+		}
+	case tcg.CardsSourceEmbedded:
+		generated := tcg.SnapshotGenerated().Format("2006-01-02")
+		fmt.Printf("%sWarning: No online or local card data available. Using built-in snapshot from %s.%s\n", colorYellow, generated, colorReset)
+		if tcg.SnapshotIsStale(time.Now()) {
+			fmt.Printf("%sThe built-in snapshot is out of date; recent sets may be missing.%s\n", colorYellow, colorReset)
 		}
 	}
+}
 
+func (m *DeckManager) handleDeckLoadMessages(deck *tcg.Deck) {
 	switch deck.LoadStatus {
 	case tcg.DeckLoadNew:
 		fmt.Printf("%sDeck file '%s' not found. Starting new deck '%s'.%s\n", colorYellow, deck.FilePath, deck.Name, colorReset)
 	case tcg.DeckLoadReset:
-		fmt.Printf("%sError decoding %s. Starting with an empty deck.%s\n", colorRed, deck.FilePath, colorReset)
+		fmt.Printf("%sError reading %s: %v%s\n", colorRed, deck.FilePath, deck.LoadError, colorReset)
+		fmt.Printf("%sA copy of the damaged file was saved to %s.%s\n", colorYellow, deck.QuarantinePath, colorReset)
+		fmt.Printf("%sRecovered %d card entr(ies) and %d battle(s). You will be asked before the file is overwritten.%s\n", colorYellow, len(deck.Cards), len(deck.BattleHistory), colorReset)
 	case tcg.DeckLoadLoaded:
 		fmt.Printf("%sDeck '%s' loaded from %s.%s\n", colorGreen, deck.Name, deck.FilePath, colorReset)
 	}
+	if migration := deck.SchemaMigration; migration != nil {
+		fmt.Printf("%sUpgraded deck file from schema version %d to %d. The original was saved to %s.%s\n", colorYellow, migration.From, migration.To, migration.BackupPath, colorReset)
+	}
+}
+
+func resolveLegacyEntries(reader *bufio.Reader, deck *tcg.Deck) {
+	migration := deck.CardMigration
+	if migration.Resolved > 0 {
+		fmt.Printf("%sLinked %d card entr(ies) to the card database.%s\n", colorGreen, migration.Resolved, colorReset)
+	}
+	if migration.Merged > 0 {
+		fmt.Printf("%sMerged %d duplicate card entr(ies).%s\n", colorGreen, migration.Merged, colorReset)
+	}
+
+	issues := append([]tcg.CardResolutionIssue(nil), migration.Issues...)
+	for _, issue := range issues {
+		entry := issue.Entry
+		if issue.Status == tcg.CardResolutionUnresolved {
+			fmt.Printf("%sWarning: Could not find %s from %s in the card database.%s\n", colorYellow, entry.Name, entry.Set, colorReset)
+			continue
+		}
+
+		fmt.Printf("%s\n%s from %s matches several cards:%s\n", colorYellow, entry.Name, entry.Set, colorReset)
+		for idx, card := range issue.Candidates {
+			fmt.Printf("  %d. %s (Set: %s, ID: %s)\n", idx+1, formatForDisplay(card.Name), formatForDisplay(card.Set), card.ID)
+		}
+		choiceStr, err := prompt(reader, fmt.Sprintf("%sEnter the number of the right card (or press Enter to skip): %s", colorWhite, colorReset))
+		if err != nil || choiceStr == "" {
+			continue
+		}
+		choice, err := strconv.Atoi(choiceStr)
+		if err != nil || choice < 1 || choice > len(issue.Candidates) {
+			fmt.Printf("%sInvalid selection. Leaving the entry as is.%s\n", colorRed, colorReset)
+			continue
+		}
+		if _, err := deck.ResolveEntry(issue.Index, issue.Candidates[choice-1].ID); err != nil {
+			fmt.Printf("%sFailed to update entry: %v%s\n", colorRed, err, colorReset)
+		}
+	}
 }
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"tcgcli/tcg"
+)
+
+func main() {
+	output := flag.String("o", "tcg/catalog_snapshot.json", "path of the snapshot to write")
+	flag.Parse()
+
+	source := &tcg.HTTPSource{
+		CardsURL: tcg.DefaultCardsURL,
+		SetsURL:  tcg.DefaultSetsURL,
+	}
+	if value := os.Getenv("TCG_CARDS_URL"); value != "" {
+		source.CardsURL = value
+	}
+	if value := os.Getenv("TCG_SETS_URL"); value != "" {
+		source.SetsURL = value
+	}
+
+	catalog, err := tcg.LoadCatalogFrom(source)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to fetch card data: %v\n", err)
+		os.Exit(1)
+	}
+
+	var buf bytes.Buffer
+	if err := tcg.WriteSnapshot(&buf, catalog.Cards(), catalog.Sets(), time.Now()); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write snapshot: %v\n", err)
+		os.Exit(1)
+	}
+	if err := os.WriteFile(*output, buf.Bytes(), 0o644); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write %s: %v\n", *output, err)
+		os.Exit(1)
+	}
+	fmt.Printf("Wrote %d cards from %s to %s\n", catalog.Len(), catalog.Origin, *output)
+}
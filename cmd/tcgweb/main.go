@@ -4,6 +4,7 @@ import (
 	"embed"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io/fs"
 	"log"
 	"net/http"
@@ -24,39 +25,141 @@ var webFS embed.FS
 
 type server struct {
 	decksDir string
+	locale   string
 
-	cardsOnce sync.Once
-	cards     []tcg.Card
-	cardsFrom tcg.CardsSource
-	cardsWarn error
-	cardsErr  error
+	catalogOnce sync.Once
+	catalog     *tcg.Catalog
+	catalogErr  error
+
+	deckLocksMu sync.Mutex
+	deckLocks   map[string]*sync.Mutex
 }
 
 type errorResponse struct {
 	Error string `json:"error"`
+	Code  string `json:"code,omitempty"`
 }
 
 type createDeckRequest struct {
 	Name string `json:"name"`
 }
 
+type renameDeckRequest struct {
+	Name string `json:"name"`
+}
+
+type duplicateDeckRequest struct {
+	Name        string `json:"name"`
+	KeepHistory bool   `json:"keep_history"`
+}
+
+type deckFormatRequest struct {
+	Format string `json:"format"`
+}
+
+type deckEnergyRequest struct {
+	EnergyTypes []string `json:"energy_types"`
+}
+
+type updateBattleRequest struct {
+	Result         *string   `json:"result"`
+	Reason         *string   `json:"reason"`
+	Opponent       *string   `json:"opponent"`
+	OpponentPlayer *string   `json:"opponent_player"`
+	TurnOrder      *string   `json:"turn_order"`
+	Points         *int      `json:"points"`
+	OpponentPoints *int      `json:"opponent_points"`
+	Turns          *int      `json:"turns"`
+	Format         *string   `json:"format"`
+	Mode           *string   `json:"mode"`
+	Notes          *string   `json:"notes"`
+	Tags           *[]string `json:"tags"`
+}
+
+func (req updateBattleRequest) apply(record *tcg.BattleRecord) {
+	if req.Result != nil {
+		record.Result = tcg.Outcome(*req.Result)
+	}
+	if req.Reason != nil {
+		record.Reason = tcg.OutcomeReason(*req.Reason)
+	}
+	if req.Opponent != nil {
+		record.Opponent = *req.Opponent
+	}
+	if req.OpponentPlayer != nil {
+		record.OpponentPlayer = *req.OpponentPlayer
+	}
+	if req.TurnOrder != nil {
+		record.TurnOrder = tcg.TurnOrder(*req.TurnOrder)
+	}
+	if req.Points != nil {
+		record.Points = *req.Points
+	}
+	if req.OpponentPoints != nil {
+		record.OpponentPoints = *req.OpponentPoints
+	}
+	if req.Turns != nil {
+		record.Turns = *req.Turns
+	}
+	if req.Format != nil {
+		record.Format = *req.Format
+	}
+	if req.Mode != nil {
+		record.Mode = tcg.GameMode(*req.Mode)
+	}
+	if req.Notes != nil {
+		record.Notes = *req.Notes
+	}
+	if req.Tags != nil {
+		record.Tags = *req.Tags
+	}
+}
+
+type mergeArchetypesRequest struct {
+	From string `json:"from"`
+	Into string `json:"into"`
+}
+
 type addCardRequest struct {
 	CardID string `json:"card_id"`
 }
 
 type recordBattleRequest struct {
-	Result   string `json:"result"`
-	Opponent string `json:"opponent"`
+	Result         string   `json:"result"`
+	Reason         string   `json:"reason"`
+	Opponent       string   `json:"opponent"`
+	OpponentPlayer string   `json:"opponent_player"`
+	TurnOrder      string   `json:"turn_order"`
+	Points         int      `json:"points"`
+	OpponentPoints int      `json:"opponent_points"`
+	Turns          int      `json:"turns"`
+	Format         string   `json:"format"`
+	Mode           string   `json:"mode"`
+	Notes          string   `json:"notes"`
+	Tags           []string `json:"tags"`
 }
 
 type deckResponse struct {
-	Name         string             `json:"name"`
-	Cards        []tcg.CardEntry    `json:"cards"`
-	Battles      []tcg.BattleRecord `json:"battles"`
-	Stats        tcg.Stats          `json:"stats"`
-	LoadStatus   tcg.DeckLoadStatus `json:"load_status"`
-	CardsSource  tcg.CardsSource    `json:"cards_source"`
-	CardsWarning string             `json:"cards_warning,omitempty"`
+	Name         string                    `json:"name"`
+	Revision     string                    `json:"revision"`
+	Cards        []tcg.CardEntry           `json:"cards"`
+	Battles      []tcg.BattleRecord        `json:"battles"`
+	Format       string                    `json:"format"`
+	Energy       []tcg.EnergyType          `json:"energy_types"`
+	Suggested    []tcg.EnergyType          `json:"suggested_energy_types"`
+	Stats        tcg.Stats                 `json:"stats"`
+	Validation   tcg.DeckValidation        `json:"validation"`
+	LoadStatus   tcg.DeckLoadStatus        `json:"load_status"`
+	CardIssues   []tcg.CardResolutionIssue `json:"card_issues,omitempty"`
+	Migration    *tcg.SchemaMigration      `json:"schema_migration,omitempty"`
+	LoadError    string                    `json:"load_error,omitempty"`
+	Quarantine   string                    `json:"quarantine_path,omitempty"`
+	CardsSource  tcg.CardsSource           `json:"cards_source"`
+	CardsOrigin  string                    `json:"cards_origin,omitempty"`
+	Locale       string                    `json:"locale"`
+	CardsWarning string                    `json:"cards_warning,omitempty"`
+	SnapshotDate string                    `json:"snapshot_date,omitempty"`
+	SnapshotOld  bool                      `json:"snapshot_stale,omitempty"`
 }
 
 func main() {
@@ -65,7 +168,7 @@ func main() {
 		addr = value
 	}
 
-	srv := &server{decksDir: "decks"}
+	srv := &server{decksDir: "decks", locale: tcg.LocaleFromEnv()}
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/api/", srv.handleAPI)
@@ -114,6 +217,26 @@ func (s *server) handleAPI(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if path == "sets" {
+		s.handleSets(w, r)
+		return
+	}
+
+	if path == "formats" {
+		s.handleFormats(w, r)
+		return
+	}
+
+	if path == "archetypes" {
+		s.handleArchetypes(w, r)
+		return
+	}
+
+	if path == "archetypes/merge" {
+		s.handleMergeArchetypes(w, r)
+		return
+	}
+
 	if strings.HasPrefix(path, "decks/") {
 		s.handleDeck(w, r, strings.TrimPrefix(path, "decks/"))
 		return
@@ -125,7 +248,7 @@ func (s *server) handleAPI(w http.ResponseWriter, r *http.Request) {
 func (s *server) handleDecks(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
-		manager, err := tcg.NewDeckManager(s.decksDir)
+		manager, err := s.deckManager(r)
 		if err != nil {
 			writeError(w, http.StatusInternalServerError, err.Error())
 			return
@@ -148,7 +271,10 @@ func (s *server) handleDecks(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		manager, err := tcg.NewDeckManager(s.decksDir)
+		unlock := s.lockDeck(name)
+		defer unlock()
+
+		manager, err := s.deckManager(r)
 		if err != nil {
 			writeError(w, http.StatusInternalServerError, err.Error())
 			return
@@ -159,15 +285,16 @@ func (s *server) handleDecks(w http.ResponseWriter, r *http.Request) {
 				writeError(w, http.StatusConflict, "deck already exists")
 				return
 			}
-			writeError(w, http.StatusInternalServerError, err.Error())
+			writeDeckError(w, err)
 			return
 		}
+		defer deck.Close()
 
 		if err := deck.Save(); err != nil {
 			writeError(w, http.StatusInternalServerError, err.Error())
 			return
 		}
-		writeJSON(w, http.StatusCreated, s.toDeckResponse(deck))
+		s.writeDeck(w, r, http.StatusCreated, deck)
 	default:
 		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
 	}
@@ -190,17 +317,26 @@ func (s *server) handleDeck(w http.ResponseWriter, r *http.Request, deckPath str
 		return
 	}
 
+	unlock := s.lockDeck(deckName)
+	defer unlock()
+
 	if len(segments) == 1 {
-		if r.Method != http.MethodGet {
+		switch r.Method {
+		case http.MethodGet:
+			deck, err := s.loadDeck(r, deckName)
+			if err != nil {
+				writeDeckError(w, err)
+				return
+			}
+			defer deck.Close()
+			s.writeDeck(w, r, http.StatusOK, deck)
+		case http.MethodPatch:
+			s.handleRenameDeck(w, r, deckName)
+		case http.MethodDelete:
+			s.handleMoveDeck(w, r, deckName, (*tcg.DeckManager).DeleteDeck)
+		default:
 			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
-			return
-		}
-		deck, err := s.loadDeck(deckName)
-		if err != nil {
-			writeError(w, http.StatusInternalServerError, err.Error())
-			return
 		}
-		writeJSON(w, http.StatusOK, s.toDeckResponse(deck))
 		return
 	}
 
@@ -208,12 +344,164 @@ func (s *server) handleDeck(w http.ResponseWriter, r *http.Request, deckPath str
 	case "cards":
 		s.handleDeckCards(w, r, deckName, segments[2:])
 	case "battles":
-		s.handleDeckBattles(w, r, deckName)
+		s.handleDeckBattles(w, r, deckName, segments[2:])
+	case "stats":
+		s.handleDeckStats(w, r, deckName)
+	case "matchups":
+		s.handleDeckMatchups(w, r, deckName)
+	case "format":
+		s.handleDeckFormat(w, r, deckName)
+	case "energy":
+		s.handleDeckEnergy(w, r, deckName)
+	case "duplicate":
+		s.handleDuplicateDeck(w, r, deckName)
+	case "archive":
+		s.handleMoveDeck(w, r, deckName, (*tcg.DeckManager).ArchiveDeck)
 	default:
 		writeError(w, http.StatusNotFound, "unknown deck endpoint")
 	}
 }
 
+func (s *server) handleDeckFormat(w http.ResponseWriter, r *http.Request, deckName string) {
+	if r.Method != http.MethodPut {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	var req deckFormatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON payload")
+		return
+	}
+
+	deck, err := s.loadDeck(r, deckName)
+	if err != nil {
+		writeDeckError(w, err)
+		return
+	}
+	defer deck.Close()
+	if !checkRevision(w, r, deck) {
+		return
+	}
+	if err := deck.SetFormat(req.Format); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !s.saveDeck(w, r, deck) {
+		return
+	}
+	s.writeDeck(w, r, http.StatusOK, deck)
+}
+
+func (s *server) handleDeckEnergy(w http.ResponseWriter, r *http.Request, deckName string) {
+	if r.Method != http.MethodPut {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	var req deckEnergyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON payload")
+		return
+	}
+	types, err := tcg.ParseEnergyTypes(strings.Join(req.EnergyTypes, ","))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	deck, err := s.loadDeck(r, deckName)
+	if err != nil {
+		writeDeckError(w, err)
+		return
+	}
+	defer deck.Close()
+	if !checkRevision(w, r, deck) {
+		return
+	}
+	if err := deck.SetEnergyTypes(types); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !s.saveDeck(w, r, deck) {
+		return
+	}
+	s.writeDeck(w, r, http.StatusOK, deck)
+}
+
+func (s *server) handleRenameDeck(w http.ResponseWriter, r *http.Request, deckName string) {
+	var req renameDeckRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON payload")
+		return
+	}
+	manager, err := s.deckManager(r)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	// lockDeck keeps other requests for this deck out between the revision
+	// check and the rename.
+	current, err := manager.LoadDeck(deckName)
+	if err != nil {
+		writeDeckError(w, err)
+		return
+	}
+	fresh := checkRevision(w, r, current)
+	current.Close()
+	if !fresh {
+		return
+	}
+	deck, err := manager.RenameDeck(deckName, req.Name)
+	if err != nil {
+		writeDeckError(w, err)
+		return
+	}
+	defer deck.Close()
+	s.writeDeck(w, r, http.StatusOK, deck)
+}
+
+func (s *server) handleDuplicateDeck(w http.ResponseWriter, r *http.Request, deckName string) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	var req duplicateDeckRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON payload")
+		return
+	}
+	manager, err := s.deckManager(r)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	deck, err := manager.DuplicateDeck(deckName, req.Name, req.KeepHistory)
+	if err != nil {
+		writeDeckError(w, err)
+		return
+	}
+	defer deck.Close()
+	s.writeDeck(w, r, http.StatusCreated, deck)
+}
+
+// handleMoveDeck serves DELETE /api/decks/{name} and POST .../archive, which
+// both move the deck file out of the deck list.
+func (s *server) handleMoveDeck(w http.ResponseWriter, r *http.Request, deckName string, move func(*tcg.DeckManager, string) error) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	manager, err := s.deckManager(r)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := move(manager, deckName); err != nil {
+		writeDeckError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
 func (s *server) handleDeckCards(w http.ResponseWriter, r *http.Request, deckName string, segments []string) {
 	switch r.Method {
 	case http.MethodPost:
@@ -232,20 +520,23 @@ func (s *server) handleDeckCards(w http.ResponseWriter, r *http.Request, deckNam
 			return
 		}
 
-		deck, err := s.loadDeck(deckName)
+		deck, err := s.loadDeck(r, deckName)
 		if err != nil {
-			writeError(w, http.StatusInternalServerError, err.Error())
+			writeDeckError(w, err)
+			return
+		}
+		defer deck.Close()
+		if !checkRevision(w, r, deck) {
 			return
 		}
 		if _, err := deck.AddCardByID(cardID); err != nil {
 			writeError(w, http.StatusBadRequest, err.Error())
 			return
 		}
-		if err := deck.Save(); err != nil {
-			writeError(w, http.StatusInternalServerError, err.Error())
+		if !s.saveDeck(w, r, deck) {
 			return
 		}
-		writeJSON(w, http.StatusOK, s.toDeckResponse(deck))
+		s.writeDeck(w, r, http.StatusOK, deck)
 	case http.MethodDelete:
 		if len(segments) != 1 {
 			writeError(w, http.StatusBadRequest, "card index required")
@@ -256,26 +547,37 @@ func (s *server) handleDeckCards(w http.ResponseWriter, r *http.Request, deckNam
 			writeError(w, http.StatusBadRequest, "invalid card index")
 			return
 		}
-		deck, err := s.loadDeck(deckName)
+		deck, err := s.loadDeck(r, deckName)
 		if err != nil {
-			writeError(w, http.StatusInternalServerError, err.Error())
+			writeDeckError(w, err)
+			return
+		}
+		defer deck.Close()
+		if !checkRevision(w, r, deck) {
 			return
 		}
 		if _, err := deck.RemoveCard(index); err != nil {
 			writeError(w, http.StatusBadRequest, err.Error())
 			return
 		}
-		if err := deck.Save(); err != nil {
-			writeError(w, http.StatusInternalServerError, err.Error())
+		if !s.saveDeck(w, r, deck) {
 			return
 		}
-		writeJSON(w, http.StatusOK, s.toDeckResponse(deck))
+		s.writeDeck(w, r, http.StatusOK, deck)
 	default:
 		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
 	}
 }
 
-func (s *server) handleDeckBattles(w http.ResponseWriter, r *http.Request, deckName string) {
+func (s *server) handleDeckBattles(w http.ResponseWriter, r *http.Request, deckName string, segments []string) {
+	if len(segments) == 1 {
+		s.handleDeckBattle(w, r, deckName, segments[0])
+		return
+	}
+	if len(segments) > 1 {
+		writeError(w, http.StatusNotFound, "unknown battles endpoint")
+		return
+	}
 	if r.Method != http.MethodPost {
 		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
 		return
@@ -292,20 +594,157 @@ func (s *server) handleDeckBattles(w http.ResponseWriter, r *http.Request, deckN
 		return
 	}
 
-	deck, err := s.loadDeck(deckName)
+	deck, err := s.loadDeck(r, deckName)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, err.Error())
+		writeDeckError(w, err)
 		return
 	}
-	if err := deck.RecordBattle(result, strings.TrimSpace(req.Opponent), time.Now()); err != nil {
+	defer deck.Close()
+	if !checkRevision(w, r, deck) {
+		return
+	}
+	record := tcg.BattleRecord{
+		Result:         tcg.Outcome(result),
+		Reason:         tcg.OutcomeReason(req.Reason),
+		Opponent:       req.Opponent,
+		OpponentPlayer: req.OpponentPlayer,
+		TurnOrder:      tcg.TurnOrder(req.TurnOrder),
+		Points:         req.Points,
+		OpponentPoints: req.OpponentPoints,
+		Turns:          req.Turns,
+		Format:         req.Format,
+		Mode:           tcg.GameMode(req.Mode),
+		Notes:          req.Notes,
+		Tags:           req.Tags,
+	}
+	if err := deck.RecordBattle(record, time.Now()); err != nil {
 		writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
-	if err := deck.Save(); err != nil {
-		writeError(w, http.StatusInternalServerError, err.Error())
+	if !s.saveDeck(w, r, deck) {
 		return
 	}
-	writeJSON(w, http.StatusOK, s.toDeckResponse(deck))
+	s.writeDeck(w, r, http.StatusOK, deck)
+}
+
+// handleDeckStats serves GET /api/decks/{name}/stats. Query parameters
+// narrow the battles counted: since and until (YYYY-MM-DD, RFC 3339 or a
+// number of days like 30d), last, mode, turn_order, opponent and tags
+// (comma separated).
+func (s *server) handleDeckStats(w http.ResponseWriter, r *http.Request, deckName string) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	options := statsOptions(r)
+	query, err := parseStatsQuery(r, options.Location)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	deck, err := s.loadDeck(r, deckName)
+	if err != nil {
+		writeDeckError(w, err)
+		return
+	}
+	defer deck.Close()
+	writeJSON(w, http.StatusOK, deck.StatsFor(query, options))
+}
+
+func parseStatsQuery(r *http.Request, location *time.Location) (tcg.StatsQuery, error) {
+	values := r.URL.Query()
+	var query tcg.StatsQuery
+	var err error
+	now := time.Now()
+	if query.Since, err = tcg.ParseStatsDate(values.Get("since"), now, location); err != nil {
+		return query, err
+	}
+	if query.Until, err = tcg.ParseStatsDate(values.Get("until"), now, location); err != nil {
+		return query, err
+	}
+	if value := strings.TrimSpace(values.Get("last")); value != "" {
+		if query.Last, err = strconv.Atoi(value); err != nil || query.Last < 0 {
+			return query, fmt.Errorf("invalid last %q", value)
+		}
+	}
+	if query.Mode, err = tcg.ParseGameMode(values.Get("mode")); err != nil {
+		return query, err
+	}
+	if query.TurnOrder, err = tcg.ParseTurnOrder(values.Get("turn_order")); err != nil {
+		return query, err
+	}
+	query.Opponent = strings.TrimSpace(values.Get("opponent"))
+	query.Tags = tcg.ParseTags(values.Get("tags"))
+	return query, nil
+}
+
+func (s *server) handleDeckMatchups(w http.ResponseWriter, r *http.Request, deckName string) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	deck, err := s.loadDeck(r, deckName)
+	if err != nil {
+		writeDeckError(w, err)
+		return
+	}
+	defer deck.Close()
+	stats := deck.StatsFor(tcg.StatsQuery{}, statsOptions(r))
+	writeJSON(w, http.StatusOK, map[string]any{
+		"matchups":  stats.Matchups,
+		"min_games": stats.MatchupMinGames,
+		"hidden":    stats.HiddenMatchups,
+	})
+}
+
+// handleDeckBattle serves PATCH and DELETE /api/decks/{name}/battles/{id}.
+// PATCH only changes the fields present in the payload.
+func (s *server) handleDeckBattle(w http.ResponseWriter, r *http.Request, deckName, battleID string) {
+	if r.Method != http.MethodPatch && r.Method != http.MethodDelete {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	battleID, err := url.PathUnescape(battleID)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid battle ID")
+		return
+	}
+	var req updateBattleRequest
+	if r.Method == http.MethodPatch {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid JSON payload")
+			return
+		}
+	}
+
+	deck, err := s.loadDeck(r, deckName)
+	if err != nil {
+		writeDeckError(w, err)
+		return
+	}
+	defer deck.Close()
+	if !checkRevision(w, r, deck) {
+		return
+	}
+	record, ok := deck.Battle(battleID)
+	if !ok {
+		writeError(w, http.StatusNotFound, "battle not found")
+		return
+	}
+	if r.Method == http.MethodDelete {
+		_, err = deck.DeleteBattle(battleID)
+	} else {
+		req.apply(&record)
+		err = deck.UpdateBattle(battleID, record)
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !s.saveDeck(w, r, deck) {
+		return
+	}
+	s.writeDeck(w, r, http.StatusOK, deck)
 }
 
 func (s *server) handleCards(w http.ResponseWriter, r *http.Request) {
@@ -314,68 +753,267 @@ func (s *server) handleCards(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	query := strings.TrimSpace(r.URL.Query().Get("search"))
-	cards, _, _, err := s.loadCards()
+	catalog, err := s.catalogFor(r)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	matches := filterCards(cards, query)
+	var matches []tcg.Card
+	if query == "" {
+		matches = catalog.Cards()
+		if len(matches) > 200 {
+			matches = matches[:200]
+		}
+	} else {
+		matches = catalog.Search(query)
+	}
 	writeJSON(w, http.StatusOK, map[string]any{"cards": matches})
 }
 
-func (s *server) loadCards() ([]tcg.Card, tcg.CardsSource, error, error) {
-	s.cardsOnce.Do(func() {
-		cards, source, warn, err := tcg.LoadValidCards()
-		s.cards = cards
-		s.cardsFrom = source
-		s.cardsWarn = warn
-		s.cardsErr = err
+func (s *server) handleSets(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	catalog, err := s.catalogFor(r)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if code := strings.TrimSpace(r.URL.Query().Get("code")); code != "" {
+		set, ok := catalog.FindSet(code)
+		if !ok {
+			writeError(w, http.StatusNotFound, "set not found")
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"set": set, "cards": catalog.FindBySet(set.Code)})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"sets": catalog.Sets()})
+}
+
+func (s *server) handleFormats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	formats, err := tcg.LoadFormats(tcg.DefaultFormatsDir())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"formats": formats.List()})
+}
+
+// handleArchetypes lists opponent archetypes (filtered by ?search= for
+// autocomplete) and registers or extends one on POST.
+func (s *server) handleArchetypes(w http.ResponseWriter, r *http.Request) {
+	manager, err := s.deckManager(r)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		search := strings.TrimSpace(r.URL.Query().Get("search"))
+		if search == "" {
+			writeJSON(w, http.StatusOK, map[string]any{"archetypes": manager.Archetypes.List()})
+			return
+		}
+		archetypes := make([]tcg.Archetype, 0)
+		for _, name := range manager.Archetypes.Suggest(search, 10) {
+			if archetype, ok := manager.Archetypes.Find(name); ok {
+				archetypes = append(archetypes, archetype)
+			}
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"archetypes": archetypes})
+	case http.MethodPost:
+		var req tcg.Archetype
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid JSON payload")
+			return
+		}
+		if err := manager.Archetypes.Add(req); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err := manager.Archetypes.Save(); err != nil {
+			writeDeckError(w, err)
+			return
+		}
+		archetype, _ := manager.Archetypes.Find(req.Name)
+		writeJSON(w, http.StatusOK, archetype)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (s *server) handleMergeArchetypes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	var req mergeArchetypesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON payload")
+		return
+	}
+	if strings.TrimSpace(req.From) == "" || strings.TrimSpace(req.Into) == "" {
+		writeError(w, http.StatusBadRequest, "both archetype names are required")
+		return
+	}
+	manager, err := s.deckManager(r)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	changed, err := manager.MergeArchetypes(req.From, req.Into)
+	if err != nil {
+		writeDeckError(w, err)
+		return
+	}
+	archetype, _ := manager.Archetypes.Find(req.Into)
+	writeJSON(w, http.StatusOK, map[string]any{"archetype": archetype, "changed": changed})
+}
+
+func (s *server) loadCatalog() (*tcg.Catalog, error) {
+	s.catalogOnce.Do(func() {
+		s.catalog, s.catalogErr = tcg.LoadCatalog()
 	})
-	return s.cards, s.cardsFrom, s.cardsWarn, s.cardsErr
+	return s.catalog, s.catalogErr
 }
 
-func (s *server) loadDeck(name string) (*tcg.Deck, error) {
-	manager, err := tcg.NewDeckManager(s.decksDir)
+// catalogFor returns the shared catalog localized for the request: an explicit
+// ?lang= wins, then Accept-Language, then the server default.
+func (s *server) catalogFor(r *http.Request) (*tcg.Catalog, error) {
+	catalog, err := s.loadCatalog()
+	if err != nil {
+		return nil, err
+	}
+	locale := tcg.NormalizeLocale(r.URL.Query().Get("lang"))
+	if locale == "" {
+		locale = tcg.MatchAcceptLanguage(r.Header.Get("Accept-Language"), catalog.Locales())
+	}
+	if locale == "" {
+		locale = s.locale
+	}
+	return catalog.WithLocale(locale), nil
+}
+
+func (s *server) deckManager(r *http.Request) (*tcg.DeckManager, error) {
+	catalog, err := s.catalogFor(r)
+	if err != nil {
+		return nil, err
+	}
+	return tcg.NewDeckManager(s.decksDir, catalog)
+}
+
+func (s *server) loadDeck(r *http.Request, name string) (*tcg.Deck, error) {
+	manager, err := s.deckManager(r)
 	if err != nil {
 		return nil, err
 	}
 	return manager.LoadDeck(name)
 }
 
-func (s *server) toDeckResponse(deck *tcg.Deck) deckResponse {
+// lockDeck serializes requests for one deck within this server; the file lock
+// only guards against other processes. Names are keyed by their slug, so
+// spellings that resolve to the same file, like "My Deck" and "my deck",
+// share a mutex.
+func (s *server) lockDeck(name string) func() {
+	name = tcg.DeckSlug(name)
+	s.deckLocksMu.Lock()
+	if s.deckLocks == nil {
+		s.deckLocks = make(map[string]*sync.Mutex)
+	}
+	lock, ok := s.deckLocks[name]
+	if !ok {
+		lock = &sync.Mutex{}
+		s.deckLocks[name] = lock
+	}
+	s.deckLocksMu.Unlock()
+
+	lock.Lock()
+	return lock.Unlock
+}
+
+// checkRevision rejects a mutation whose If-Match header names an older
+// revision of the deck with 412, so the client can refetch and retry.
+func checkRevision(w http.ResponseWriter, r *http.Request, deck *tcg.Deck) bool {
+	match := strings.TrimSpace(r.Header.Get("If-Match"))
+	if match == "" || match == "*" {
+		return true
+	}
+	for _, tag := range strings.Split(match, ",") {
+		tag = strings.Trim(strings.TrimPrefix(strings.TrimSpace(tag), "W/"), `"`)
+		if tag == deck.Revision() {
+			return true
+		}
+	}
+	writeJSON(w, http.StatusPreconditionFailed, errorResponse{Error: "deck changed since it was loaded", Code: "stale_revision"})
+	return false
+}
+
+func (s *server) writeDeck(w http.ResponseWriter, r *http.Request, status int, deck *tcg.Deck) {
+	response := s.toDeckResponse(deck, statsOptions(r))
+	w.Header().Set("ETag", `"`+response.Revision+`"`)
+	writeJSON(w, status, response)
+}
+
+// saveDeck writes deck and reports failures to the client. A deck whose file
+// could not be decoded is only overwritten when the request carries
+// ?confirm_overwrite=true; otherwise it answers 409 so the UI can ask first.
+func (s *server) saveDeck(w http.ResponseWriter, r *http.Request, deck *tcg.Deck) bool {
+	if confirm, _ := strconv.ParseBool(r.URL.Query().Get("confirm_overwrite")); confirm {
+		deck.ConfirmOverwrite()
+	}
+	err := deck.Save()
+	if errors.Is(err, tcg.ErrUnconfirmedOverwrite) {
+		writeJSON(w, http.StatusConflict, errorResponse{Error: err.Error(), Code: "overwrite_unconfirmed"})
+		return false
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return false
+	}
+	return true
+}
+
+func (s *server) toDeckResponse(deck *tcg.Deck, options tcg.StatsOptions) deckResponse {
 	warning := ""
-	if deck.CardsLoadError != nil {
-		warning = deck.CardsLoadError.Error()
+	if deck.Catalog.Warning != nil {
+		warning = deck.Catalog.Warning.Error()
 	}
 
-	return deckResponse{
+	response := deckResponse{
 		Name:         deck.Name,
-		Cards:        deck.Cards,
+		Revision:     deck.Revision(),
+		Cards:        deck.DisplayCards(),
 		Battles:      deck.BattleHistory,
-		Stats:        deck.Stats(),
+		Format:       deck.ActiveFormat().Name,
+		Energy:       deck.EnergyTypes,
+		Suggested:    deck.SuggestEnergyTypes(),
+		Stats:        deck.StatsFor(tcg.StatsQuery{}, options),
+		Validation:   deck.Validate(),
 		LoadStatus:   deck.LoadStatus,
-		CardsSource:  deck.CardsSource,
+		CardIssues:   deck.CardMigration.Issues,
+		Migration:    deck.SchemaMigration,
+		Quarantine:   deck.QuarantinePath,
+		CardsSource:  deck.Catalog.Source,
+		CardsOrigin:  deck.Catalog.Origin,
+		Locale:       deck.Catalog.Locale(),
 		CardsWarning: warning,
 	}
-}
-
-func filterCards(cards []tcg.Card, term string) []tcg.Card {
-	if term == "" {
-		if len(cards) > 200 {
-			return cards[:200]
-		}
-		return cards
+	if deck.LoadError != nil {
+		response.LoadError = deck.LoadError.Error()
 	}
-
-	normalized := strings.ToLower(term)
-	var matches []tcg.Card
-	for _, card := range cards {
-		if strings.Contains(strings.ToLower(card.Name), normalized) || strings.Contains(strings.ToLower(card.Set), normalized) || strings.Contains(strings.ToLower(card.ID), normalized) {
-			matches = append(matches, card)
-		}
+	if deck.Catalog.Source == tcg.CardsSourceEmbedded {
+		response.SnapshotDate = tcg.SnapshotGenerated().Format("2006-01-02")
+		response.SnapshotOld = tcg.SnapshotIsStale(time.Now())
 	}
-	return matches
+	return response
 }
 
 func writeJSON(w http.ResponseWriter, status int, data interface{}) {
@@ -389,3 +1027,46 @@ func writeJSON(w http.ResponseWriter, status int, data interface{}) {
 func writeError(w http.ResponseWriter, status int, message string) {
 	writeJSON(w, status, errorResponse{Error: message})
 }
+
+// statsOptions buckets stats in the browser's time zone, sent by the web UI
+// as X-Time-Zone, when the server knows it. ?min_games= overrides the
+// matchup threshold and ?posterior=true adds the Bayesian estimate.
+func statsOptions(r *http.Request) tcg.StatsOptions {
+	options := tcg.DefaultStatsOptions()
+	if name := strings.TrimSpace(r.Header.Get("X-Time-Zone")); name != "" {
+		if location, err := time.LoadLocation(name); err == nil {
+			options.Location = location
+		}
+	}
+	if value, err := strconv.Atoi(r.URL.Query().Get("min_games")); err == nil && value >= 0 {
+		options.MinMatchupGames = value
+	}
+	if value, err := strconv.ParseBool(r.URL.Query().Get("posterior")); err == nil {
+		options.Posterior = value
+	}
+	return options
+}
+
+func writeDeckError(w http.ResponseWriter, err error) {
+	if errors.Is(err, tcg.ErrDeckLocked) {
+		writeError(w, http.StatusLocked, err.Error())
+		return
+	}
+	if errors.Is(err, tcg.ErrInvalidDeckName) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errors.Is(err, os.ErrExist) {
+		writeError(w, http.StatusConflict, "deck already exists")
+		return
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if errors.Is(err, tcg.ErrUnconfirmedOverwrite) {
+		writeJSON(w, http.StatusConflict, errorResponse{Error: err.Error(), Code: "overwrite_unconfirmed"})
+		return
+	}
+	writeError(w, http.StatusInternalServerError, err.Error())
+}
@@ -1,6 +1,7 @@
 const state = {
   decks: [],
   currentDeck: null,
+  lastBattle: null,
 };
 
 const deckSelect = document.getElementById("deckSelect");
@@ -12,6 +13,12 @@ const searchResults = document.getElementById("searchResults");
 const statsGrid = document.getElementById("statsGrid");
 const lossList = document.getElementById("lossList");
 const deckStatus = document.getElementById("deckStatus");
+const deckLegality = document.getElementById("deckLegality");
+const deckIssues = document.getElementById("deckIssues");
+const formatSelect = document.getElementById("formatSelect");
+const energyTypes = document.getElementById("energyTypes");
+const archetypeOptions = document.getElementById("archetypeOptions");
+const undoBattle = document.getElementById("undoBattle");
 const connectionStatus = document.getElementById("connectionStatus");
 const themeSelect = document.getElementById("themeSelect");
 const backgroundUpload = document.getElementById("backgroundUpload");
@@ -19,8 +26,11 @@ const clearBackground = document.getElementById("clearBackground");
 const battleChart = document.getElementById("battleChart");
 const battleChartNotice = document.getElementById("battleChartNotice");
 
+const languageSelect = document.getElementById("languageSelect");
+
 const THEME_KEY = "tcgcli-theme";
 const BG_KEY = "tcgcli-background";
+const LANG_KEY = "tcgcli-language";
 
 function setStatus(text, variant = "info") {
   connectionStatus.textContent = text;
@@ -32,40 +42,94 @@ function formatBattleTimestamp(value) {
   if (!value) {
     return "";
   }
-  const [datePart, timePart] = value.split(" ");
-  if (!datePart) {
-    return value;
+  const date = new Date(value);
+  if (Number.isNaN(date.getTime()) || date.getFullYear() <= 1) {
+    return "";
+  }
+  return date.toLocaleString(undefined, {
+    month: "numeric",
+    day: "numeric",
+    hour: "2-digit",
+    minute: "2-digit",
+  });
+}
+
+// formatWinRate shows a win rate with its Wilson interval, e.g.
+// "58% (49–66%)", and flags small samples.
+function formatWinRate(estimate) {
+  if (!estimate || !estimate.games) {
+    return "n/a";
+  }
+  const text = `${Math.round(estimate.rate)}% (${Math.round(estimate.low)}–${Math.round(estimate.high)}%)`;
+  return estimate.smallSample ? `${text} · small sample` : text;
+}
+
+const OUTCOME_LABELS = { W: "Win", L: "Loss", T: "Tie" };
+
+function describeReason(battle) {
+  const won = battle.result === "W";
+  switch (battle.reason) {
+    case "points":
+      return "on points";
+    case "no_pokemon":
+      return battle.result === "T" ? "both sides out of Pokémon" : "no Pokémon left";
+    case "deck_out":
+      return "deck out";
+    case "concede":
+      return won ? "opponent conceded" : "conceded";
+    case "disconnect":
+      return won ? "opponent disconnected" : "disconnected";
+    case "turn_limit":
+      return "turn limit";
+    default:
+      return battle.reason || "";
+  }
+}
+
+function describeBattle(battle) {
+  const parts = [];
+  if (battle.reason) {
+    parts.push(describeReason(battle));
+  }
+  if (battle.opponent_player) {
+    parts.push(`vs ${battle.opponent_player}`);
+  }
+  if (battle.turn_order) {
+    parts.push(`went ${battle.turn_order}`);
+  }
+  if (battle.points || battle.opponent_points) {
+    parts.push(`${battle.points || 0}–${battle.opponent_points || 0} pts`);
   }
-  const [year, month, day] = datePart.split("-");
-  if (!month || !day) {
-    return value;
+  if (battle.turns) {
+    parts.push(`${battle.turns} turns`);
   }
-  const formattedDate = `${Number(month)}/${Number(day)}`;
-  if (!timePart) {
-    return formattedDate;
+  if (battle.mode) {
+    parts.push(battle.mode);
   }
-  const [hour, minute] = timePart.split(":");
-  if (!hour || !minute) {
-    return formattedDate;
+  if (battle.format) {
+    parts.push(battle.format);
   }
-  return `${formattedDate} ${hour}:${minute}`;
+  if (battle.tags && battle.tags.length) {
+    parts.push(battle.tags.map((tag) => `#${tag}`).join(" "));
+  }
+  return parts.join(" · ");
 }
 
-function splitOpponent(opponent) {
-  if (!opponent) {
-    return { name: "Unknown", details: "" };
+function describeCard(card) {
+  const parts = [];
+  if (card.type) {
+    parts.push(card.stage ? `${card.type} · ${card.stage}` : card.type);
   }
-  const separators = [" — ", " - ", " | ", ": "];
-  for (const separator of separators) {
-    if (opponent.includes(separator)) {
-      const [name, ...rest] = opponent.split(separator);
-      return {
-        name: name.trim() || "Unknown",
-        details: rest.join(separator).trim(),
-      };
-    }
+  if (card.element) {
+    parts.push(card.element);
+  }
+  if (card.hp) {
+    parts.push(`${card.hp} HP`);
   }
-  return { name: opponent.trim(), details: "" };
+  if (card.rarity) {
+    parts.push(card.rarity);
+  }
+  return parts.join(" · ");
 }
 
 function applyTheme(theme) {
@@ -104,6 +168,10 @@ function loadAppearanceSettings() {
     applyTheme(storedTheme);
   }
 
+  if (languageSelect) {
+    languageSelect.value = localStorage.getItem(LANG_KEY) || "";
+  }
+
   const storedBackground = localStorage.getItem(BG_KEY);
   if (storedBackground) {
     setCustomBackground(storedBackground);
@@ -115,14 +183,26 @@ function loadAppearanceSettings() {
 }
 
 async function apiFetch(path, options = {}) {
+  const headers = { "Content-Type": "application/json" };
+  const timeZone = Intl.DateTimeFormat().resolvedOptions().timeZone;
+  if (timeZone) {
+    headers["X-Time-Zone"] = timeZone;
+  }
+  const language = localStorage.getItem(LANG_KEY);
+  if (language) {
+    headers["Accept-Language"] = language;
+  }
   try {
     const response = await fetch(path, {
-      headers: { "Content-Type": "application/json" },
       ...options,
+      headers: { ...headers, ...(options.headers || {}) },
     });
-    const data = await response.json();
+    const data = response.status === 204 ? {} : await response.json();
     if (!response.ok) {
-      throw new Error(data.error || "Request failed");
+      const error = new Error(data.error || "Request failed");
+      error.status = response.status;
+      error.code = data.code;
+      throw error;
     }
     setStatus("Connected");
     return data;
@@ -132,6 +212,48 @@ async function apiFetch(path, options = {}) {
   }
 }
 
+// mutateDeck sends a change built from the current deck. The request carries
+// the deck revision; if the deck changed elsewhere it is reloaded and the
+// change rebuilt once against the fresh copy.
+async function mutateDeck(buildRequest, confirmOverwrite = false, retried = false) {
+  const current = state.currentDeck;
+  const request = buildRequest(current);
+  if (!request) {
+    deckNotice.textContent = "The deck changed elsewhere and that change no longer applies.";
+    return current;
+  }
+  let path = request.path;
+  if (confirmOverwrite) {
+    path += `${path.includes("?") ? "&" : "?"}confirm_overwrite=true`;
+  }
+  try {
+    return await apiFetch(path, {
+      ...request.options,
+      headers: { "If-Match": `"${current.revision}"` },
+    });
+  } catch (error) {
+    if (error.code === "stale_revision" && !retried) {
+      const fresh = await apiFetch(`/api/decks/${encodeURIComponent(current.name)}`);
+      renderDeck(fresh);
+      deckNotice.textContent = "The deck changed elsewhere. Reloaded it and retried.";
+      return mutateDeck(buildRequest, confirmOverwrite, true);
+    }
+    if (error.code === "overwrite_unconfirmed" && !confirmOverwrite) {
+      const replace = window.confirm("This deck file could not be read and a copy was quarantined. Overwrite it with the recovered deck?");
+      if (!replace) {
+        deckNotice.textContent = "Change not saved. The deck file was left untouched.";
+        throw error;
+      }
+      return mutateDeck(buildRequest, true, retried);
+    }
+    throw error;
+  }
+}
+
+function escapeHTML(value) {
+  return String(value ?? "").replace(/[&<>"']/g, (char) => `&#${char.charCodeAt(0)};`);
+}
+
 function updateDeckSelect() {
   deckSelect.innerHTML = '<option value="">Select a deck</option>';
   state.decks.forEach((deck) => {
@@ -142,14 +264,54 @@ function updateDeckSelect() {
   });
 }
 
+function renderValidation(validation) {
+  deckIssues.innerHTML = "";
+  if (!validation) {
+    deckLegality.textContent = "";
+    return;
+  }
+  deckLegality.textContent = validation.legal ? "Legal" : "Not legal";
+  deckLegality.classList.toggle("pill--error", !validation.legal);
+  (validation.issues || []).forEach((issue) => {
+    const item = document.createElement("li");
+    item.className = issue.severity;
+    item.textContent = `${issue.severity === "error" ? "Error" : "Warning"}: ${issue.message}`;
+    deckIssues.appendChild(item);
+  });
+}
+
 function renderDeck(deck) {
   state.currentDeck = deck;
+  renderUndo(deck);
   deckStatus.textContent = deck.load_status || "ready";
   deckStatus.style.background = deck.cards_warning ? "rgba(248, 113, 113, 0.2)" : "rgba(74, 222, 128, 0.2)";
   deckStatus.style.color = deck.cards_warning ? "#fecaca" : "#4ade80";
 
-  const warning = deck.cards_warning ? `<br /><span class="muted">Card data warning: ${deck.cards_warning}</span>` : "";
-  deckMeta.innerHTML = `Cards source: ${deck.cards_source || "unknown"}.${warning}`;
+  const warning = deck.cards_warning ? `<br /><span class="muted">Card data warning: ${escapeHTML(deck.cards_warning)}</span>` : "";
+  let snapshot = "";
+  if (deck.snapshot_date) {
+    snapshot = `<br /><span class="muted">Using built-in card snapshot from ${escapeHTML(deck.snapshot_date)}.${deck.snapshot_stale ? " It is out of date; recent sets may be missing." : ""}</span>`;
+  }
+  const issues = (deck.card_issues || [])
+    .map((issue) => {
+      const entry = issue.entry || {};
+      const reason = issue.status === "ambiguous" ? `matches ${issue.candidates.length} cards` : "not found in the card database";
+      return `<br /><span class="muted">Card entry ${escapeHTML(entry.name)} (${escapeHTML(entry.set)}) ${reason}.</span>`;
+    })
+    .join("");
+  const migration = deck.schema_migration
+    ? `<br /><span class="muted">Deck file upgraded from schema version ${deck.schema_migration.from} to ${deck.schema_migration.to}; the original was backed up.</span>`
+    : "";
+  const loadError = deck.load_error
+    ? `<br /><span class="muted">Deck file could not be read (${escapeHTML(deck.load_error)}). A copy was saved to ${escapeHTML(deck.quarantine_path)}; recovered ${deck.cards.length} card entries and ${deck.battles.length} battles.</span>`
+    : "";
+  deckMeta.innerHTML = `Cards source: ${escapeHTML(deck.cards_source || "unknown")}.${warning}${snapshot}${issues}${migration}${loadError}`;
+
+  renderValidation(deck.validation);
+  formatSelect.value = deck.format || "standard";
+  energyTypes.value = (deck.energy_types || []).join(", ");
+  const suggested = deck.suggested_energy_types || [];
+  energyTypes.placeholder = suggested.length ? `Suggested: ${suggested.join(", ")}` : "e.g. lightning, fighting";
 
   deckCards.innerHTML = "";
   if (deck.cards.length === 0) {
@@ -160,10 +322,10 @@ function renderDeck(deck) {
       item.className = "card-item";
       item.innerHTML = `
         <header>
-          <strong>${entry.name}</strong>
-          <span class="muted">${entry.count}x</span>
+          <strong>${escapeHTML(entry.name)}</strong>
+          <span class="muted">${escapeHTML(entry.count)}x</span>
         </header>
-        <div class="muted">${entry.set}</div>
+        <div class="muted">${escapeHTML(entry.set)}</div>
         <button type="button" class="danger" data-index="${index}">Remove</button>
       `;
       item.querySelector("button").addEventListener("click", () => removeCard(index));
@@ -177,16 +339,16 @@ function renderDeck(deck) {
   } else {
     deck.battles.slice().reverse().forEach((battle) => {
       const item = document.createElement("li");
-      const isLoss = battle.result.toUpperCase() === "L";
-      const opponent = splitOpponent(battle.opponent);
-      const opponentDetails = opponent.details ? `<span class="muted">${opponent.details}</span>` : "";
-      item.className = `battle-item ${isLoss ? "loss" : ""}`;
+      const result = (battle.result || "").toUpperCase();
+      const details = describeBattle(battle);
+      item.className = `battle-item ${result === "L" ? "loss" : result === "T" ? "tie" : ""}`;
       item.innerHTML = `
-        <strong>${battle.result === "W" ? "Win" : "Loss"}</strong>
-        <span class="muted">${formatBattleTimestamp(battle.date)}</span>
+        <strong>${escapeHTML(OUTCOME_LABELS[result] || battle.result)}</strong>
+        <span class="muted">${escapeHTML(formatBattleTimestamp(battle.date))}</span>
         <div class="battle-opponent">
-          <span>${opponent.name}</span>
-          ${opponentDetails}
+          <span>${escapeHTML(battle.opponent || "Unknown")}</span>
+          ${details ? `<span class="muted">${escapeHTML(details)}</span>` : ""}
+          ${battle.notes ? `<span class="muted">${escapeHTML(battle.notes)}</span>` : ""}
         </div>
       `;
       battleHistory.appendChild(item);
@@ -199,8 +361,16 @@ function renderDeck(deck) {
     { label: "Total Battles", value: stats.totalBattles ?? 0 },
     { label: "Wins", value: stats.wins ?? 0 },
     { label: "Losses", value: stats.losses ?? 0 },
-    { label: "Win %", value: stats.winPercentage ? stats.winPercentage.toFixed(2) + "%" : "0%" },
+    { label: "Ties", value: stats.ties ?? 0 },
+    { label: "Win rate (95% range)", value: formatWinRate(stats.winRate) },
   ];
+  const posterior = stats.winRate && stats.winRate.posterior;
+  if (posterior) {
+    statItems.push({
+      label: "Bayesian estimate",
+      value: `${Math.round(posterior.mean)}% (${Math.round(posterior.low)}–${Math.round(posterior.high)}%)`,
+    });
+  }
 
   statItems.forEach((stat) => {
     const card = document.createElement("div");
@@ -210,26 +380,31 @@ function renderDeck(deck) {
   });
 
   lossList.innerHTML = "";
-  if (stats.lossByOpponent && Object.keys(stats.lossByOpponent).length > 0) {
+  const matchups = stats.matchups || [];
+  if (matchups.length > 0) {
     const list = document.createElement("ul");
     list.className = "card-list";
-    Object.entries(stats.lossByOpponent).forEach(([opponent, count]) => {
+    matchups.forEach((matchup) => {
       const item = document.createElement("li");
       item.className = "result-item";
-      const opponentInfo = splitOpponent(opponent);
-      const details = opponentInfo.details || "No details";
       item.innerHTML = `
-        <strong>${opponentInfo.name}</strong>
+        <strong>${escapeHTML(matchup.opponent)}</strong>
         <div class="result-meta">
-          <span>${details}</span>
-          <span>${count} loss(es)</span>
+          <span>${matchup.wins}W ${matchup.losses}L ${matchup.ties}T · ${matchup.games} game(s)</span>
+          <span>${formatWinRate(matchup.winRate)}</span>
         </div>
       `;
       list.appendChild(item);
     });
     lossList.appendChild(list);
   } else {
-    lossList.textContent = "No loss breakdown yet.";
+    lossList.textContent = `No opponent has ${stats.matchupMinGames || 1} or more games yet.`;
+  }
+  if (stats.hiddenMatchups) {
+    const note = document.createElement("p");
+    note.className = "muted";
+    note.textContent = `${stats.hiddenMatchups} opponent(s) with fewer than ${stats.matchupMinGames} games not shown.`;
+    lossList.appendChild(note);
   }
 
   renderBattleChart(deck);
@@ -255,24 +430,28 @@ function renderBattleChart(deck) {
   const minWidth = 640;
   let wins = 0;
   let losses = 0;
+  let ties = 0;
 
   const points = battles.map((battle, index) => {
     if (battle.result === "W") {
       wins += 1;
     } else if (battle.result === "L") {
       losses += 1;
+    } else if (battle.result === "T") {
+      ties += 1;
     }
     return {
       index,
       wins,
       losses,
+      ties,
       date: formatBattleTimestamp(battle.date),
     };
   });
 
   const maxX = Math.max(points.length - 1, 1);
   const width = Math.max(minWidth, paddingX * 2 + maxX * widthPerPoint);
-  const maxY = Math.max(1, ...points.map((point) => Math.max(point.wins, point.losses)));
+  const maxY = Math.max(1, ...points.map((point) => Math.max(point.wins, point.losses, point.ties)));
   const yScale = (height - paddingY * 2) / maxY;
 
   const xCoord = (index) => paddingX + index * widthPerPoint;
@@ -286,6 +465,10 @@ function renderBattleChart(deck) {
     x: xCoord(point.index),
     y: yCoord(point.losses),
   }));
+  const tieCoords = points.map((point) => ({
+    x: xCoord(point.index),
+    y: yCoord(point.ties),
+  }));
 
   const axis = `
     <line class="chart-axis" x1="${paddingX}" y1="${paddingY}" x2="${paddingX}" y2="${height - paddingY}" />
@@ -303,6 +486,9 @@ function renderBattleChart(deck) {
   const lossesPath = lossCoords
     .map((point, index) => `${index === 0 ? "M" : "L"}${point.x},${point.y}`)
     .join(" ");
+  const tiesPath = tieCoords
+    .map((point, index) => `${index === 0 ? "M" : "L"}${point.x},${point.y}`)
+    .join(" ");
 
   const winsCircles = winsCoords
     .map((point) => `<circle class="chart-point wins" cx="${point.x}" cy="${point.y}" r="4" />`)
@@ -310,6 +496,9 @@ function renderBattleChart(deck) {
   const lossesCircles = lossCoords
     .map((point) => `<circle class="chart-point losses" cx="${point.x}" cy="${point.y}" r="4" />`)
     .join("");
+  const tiesCircles = tieCoords
+    .map((point) => `<circle class="chart-point ties" cx="${point.x}" cy="${point.y}" r="4" />`)
+    .join("");
 
   const labelInterval = Math.max(1, Math.ceil(points.length / 6));
   const labels = points
@@ -317,14 +506,14 @@ function renderBattleChart(deck) {
     .map((point) => {
       const x = xCoord(point.index);
       const y = height - paddingY + 18;
-      return `<text class="chart-label" x="${x}" y="${y}" text-anchor="middle">${point.date}</text>`;
+      return `<text class="chart-label" x="${x}" y="${y}" text-anchor="middle">${escapeHTML(point.date)}</text>`;
     })
     .join("");
 
   battleChart.setAttribute("viewBox", `0 0 ${width} ${height}`);
   battleChart.setAttribute("width", width);
   battleChart.setAttribute("height", height);
-  battleChart.innerHTML = `${gridLines}${axis}<path class="chart-path wins" d="${winsPath}" /><path class="chart-path losses" d="${lossesPath}" />${winsCircles}${lossesCircles}${labels}`;
+  battleChart.innerHTML = `${gridLines}${axis}<path class="chart-path wins" d="${winsPath}" /><path class="chart-path losses" d="${lossesPath}" /><path class="chart-path ties" d="${tiesPath}" />${winsCircles}${lossesCircles}${tiesCircles}${labels}`;
 }
 
 async function loadDecks() {
@@ -333,6 +522,52 @@ async function loadDecks() {
   updateDeckSelect();
 }
 
+async function loadFormats() {
+  const data = await apiFetch("/api/formats");
+  formatSelect.innerHTML = "";
+  (data.formats || []).forEach((format) => {
+    const option = document.createElement("option");
+    option.value = format.name;
+    option.textContent = format.description ? `${format.name} — ${format.description}` : format.name;
+    formatSelect.appendChild(option);
+  });
+}
+
+async function setFormat(format) {
+  if (!state.currentDeck) {
+    deckNotice.textContent = "Load a deck before choosing a format.";
+    return;
+  }
+  const deck = await mutateDeck((current) => ({
+    path: `/api/decks/${encodeURIComponent(current.name)}/format`,
+    options: {
+      method: "PUT",
+      body: JSON.stringify({ format }),
+    },
+  }));
+  renderDeck(deck);
+}
+
+async function setEnergyTypes(event) {
+  event.preventDefault();
+  if (!state.currentDeck) {
+    deckNotice.textContent = "Load a deck before setting energy types.";
+    return;
+  }
+  let types = energyTypes.value.split(",").map((value) => value.trim()).filter(Boolean);
+  if (types.length === 0) {
+    types = state.currentDeck.suggested_energy_types || [];
+  }
+  const deck = await mutateDeck((current) => ({
+    path: `/api/decks/${encodeURIComponent(current.name)}/energy`,
+    options: {
+      method: "PUT",
+      body: JSON.stringify({ energy_types: types }),
+    },
+  }));
+  renderDeck(deck);
+}
+
 async function loadDeck(name) {
   if (!name) {
     deckNotice.textContent = "Select a deck to load.";
@@ -362,6 +597,77 @@ async function createDeck(event) {
   renderDeck(deck);
 }
 
+function clearDeck() {
+  state.currentDeck = null;
+  renderUndo(null);
+  deckStatus.textContent = "";
+  renderValidation(null);
+  deckMeta.innerHTML = "";
+  deckCards.innerHTML = "";
+  battleHistory.innerHTML = "";
+  statsGrid.innerHTML = "";
+  lossList.innerHTML = "";
+}
+
+async function renameDeck() {
+  if (!state.currentDeck) {
+    deckNotice.textContent = "Load a deck to rename it.";
+    return;
+  }
+  const name = window.prompt("New deck name", state.currentDeck.name);
+  if (!name || !name.trim()) {
+    return;
+  }
+  const deck = await mutateDeck((current) => ({
+    path: `/api/decks/${encodeURIComponent(current.name)}`,
+    options: { method: "PATCH", body: JSON.stringify({ name: name.trim() }) },
+  }));
+  deckNotice.textContent = `Renamed to ${deck.name}.`;
+  await loadDecks();
+  deckSelect.value = deck.name;
+  renderDeck(deck);
+}
+
+async function duplicateDeck() {
+  if (!state.currentDeck) {
+    deckNotice.textContent = "Load a deck to duplicate it.";
+    return;
+  }
+  const name = window.prompt("Name for the copy", `${state.currentDeck.name} (copy)`);
+  if (!name || !name.trim()) {
+    return;
+  }
+  const keepHistory = window.confirm("Copy the battle history too?");
+  const deck = await apiFetch(`/api/decks/${encodeURIComponent(state.currentDeck.name)}/duplicate`, {
+    method: "POST",
+    body: JSON.stringify({ name: name.trim(), keep_history: keepHistory }),
+  });
+  deckNotice.textContent = `Created ${deck.name}.`;
+  await loadDecks();
+  deckSelect.value = deck.name;
+  renderDeck(deck);
+}
+
+async function retireDeck(action) {
+  if (!state.currentDeck) {
+    deckNotice.textContent = `Load a deck to ${action} it.`;
+    return;
+  }
+  const name = state.currentDeck.name;
+  if (!window.confirm(`${action === "delete" ? "Delete" : "Archive"} ${name}?`)) {
+    return;
+  }
+  const path = `/api/decks/${encodeURIComponent(name)}`;
+  if (action === "delete") {
+    await apiFetch(path, { method: "DELETE" });
+  } else {
+    await apiFetch(`${path}/archive`, { method: "POST" });
+  }
+  deckNotice.textContent = action === "delete" ? `Moved ${name} to the trash.` : `Archived ${name}.`;
+  clearDeck();
+  await loadDecks();
+}
+
 async function searchCards(event) {
   event.preventDefault();
   const term = document.getElementById("searchTerm").value.trim();
@@ -377,13 +683,15 @@ async function searchCards(event) {
   cards.slice(0, 50).forEach((card) => {
     const item = document.createElement("li");
     item.className = "result-item";
+    const details = describeCard(card);
     item.innerHTML = `
       <header>
-        <strong>${card.name}</strong>
+        <strong>${escapeHTML(card.name)}</strong>
         <button type="button">Add</button>
       </header>
-      <div class="muted">${card.set}</div>
-      <div class="muted">ID: ${card.id}</div>
+      <div class="muted">${escapeHTML(card.set)}</div>
+      ${details ? `<div class="muted">${escapeHTML(details)}</div>` : ""}
+      <div class="muted">ID: ${escapeHTML(card.id)}</div>
     `;
     item.querySelector("button").addEventListener("click", () => addCard(card.id));
     searchResults.appendChild(item);
@@ -395,10 +703,13 @@ async function addCard(cardID) {
     deckNotice.textContent = "Load a deck before adding cards.";
     return;
   }
-  const deck = await apiFetch(`/api/decks/${encodeURIComponent(state.currentDeck.name)}/cards`, {
-    method: "POST",
-    body: JSON.stringify({ card_id: cardID }),
-  });
+  const deck = await mutateDeck((current) => ({
+    path: `/api/decks/${encodeURIComponent(current.name)}/cards`,
+    options: {
+      method: "POST",
+      body: JSON.stringify({ card_id: cardID }),
+    },
+  }));
   renderDeck(deck);
 }
 
@@ -406,8 +717,18 @@ async function removeCard(index) {
   if (!state.currentDeck) {
     return;
   }
-  const deck = await apiFetch(`/api/decks/${encodeURIComponent(state.currentDeck.name)}/cards/${index}`, {
-    method: "DELETE",
+  const target = state.currentDeck.cards[index];
+  const deck = await mutateDeck((current) => {
+    const position = current.cards.findIndex((entry) =>
+      target.id ? entry.id === target.id : entry.name === target.name && entry.set === target.set,
+    );
+    if (position < 0) {
+      return null;
+    }
+    return {
+      path: `/api/decks/${encodeURIComponent(current.name)}/cards/${position}`,
+      options: { method: "DELETE" },
+    };
   });
   renderDeck(deck);
 }
@@ -418,24 +739,110 @@ async function recordBattle(event) {
     deckNotice.textContent = "Load a deck before recording battles.";
     return;
   }
-  const result = document.getElementById("battleResult").value;
-  const opponentName = document.getElementById("opponentDeck").value.trim();
-  const opponentDetails = document.getElementById("opponentDetails").value.trim();
-  const opponentBase = opponentName || "Unknown";
-  const opponent = opponentDetails ? `${opponentBase} — ${opponentDetails}` : opponentBase;
-  const deck = await apiFetch(`/api/decks/${encodeURIComponent(state.currentDeck.name)}/battles`, {
-    method: "POST",
-    body: JSON.stringify({ result, opponent }),
+  const field = (id) => document.getElementById(id);
+  const number = (id) => Number.parseInt(field(id).value, 10) || 0;
+  const battle = {
+    result: field("battleResult").value,
+    reason: field("battleReason").value,
+    opponent: field("opponentDeck").value.trim() || "Unknown",
+    opponent_player: field("opponentPlayer").value.trim(),
+    turn_order: field("turnOrder").value,
+    points: number("battlePoints"),
+    opponent_points: number("opponentPoints"),
+    turns: number("battleTurns"),
+    mode: field("gameMode").value,
+    notes: field("battleNotes").value.trim(),
+    tags: field("battleTags").value.split(",").map((tag) => tag.trim()).filter(Boolean),
+  };
+  const deck = await mutateDeck((current) => ({
+    path: `/api/decks/${encodeURIComponent(current.name)}/battles`,
+    options: {
+      method: "POST",
+      body: JSON.stringify(battle),
+    },
+  }));
+  const added = deck.battles[deck.battles.length - 1];
+  state.lastBattle = added ? { deck: deck.name, id: added.id } : null;
+  ["battleReason", "opponentDeck", "opponentPlayer", "battlePoints", "opponentPoints", "battleTurns", "battleNotes", "battleTags"].forEach((id) => {
+    field(id).value = "";
   });
-  document.getElementById("opponentDeck").value = "";
-  document.getElementById("opponentDetails").value = "";
+  renderDeck(deck);
+  await loadArchetypes();
+}
+
+// renderUndo offers "Undo last record" while the battle recorded last is
+// still in the deck on screen.
+function renderUndo(deck) {
+  const last = state.lastBattle;
+  if (last && (!deck || deck.name !== last.deck || !deck.battles.some((battle) => battle.id === last.id))) {
+    state.lastBattle = null;
+  }
+  undoBattle.hidden = !state.lastBattle;
+}
+
+async function undoLastBattle() {
+  const last = state.lastBattle;
+  if (!last || !state.currentDeck) {
+    return;
+  }
+  const before = state.currentDeck;
+  const deck = await mutateDeck((current) => {
+    if (!current.battles.some((battle) => battle.id === last.id)) {
+      return null;
+    }
+    return {
+      path: `/api/decks/${encodeURIComponent(current.name)}/battles/${encodeURIComponent(last.id)}`,
+      options: { method: "DELETE" },
+    };
+  });
+  state.lastBattle = null;
+  if (deck !== before) {
+    deckNotice.textContent = "Removed the last recorded battle.";
+  }
   renderDeck(deck);
 }
 
+async function loadArchetypes() {
+  const data = await apiFetch("/api/archetypes");
+  archetypeOptions.innerHTML = "";
+  (data.archetypes || []).forEach((archetype) => {
+    [archetype.name, ...(archetype.aliases || [])].forEach((value) => {
+      const option = document.createElement("option");
+      option.value = value;
+      if (value !== archetype.name) {
+        option.label = `${value} → ${archetype.name}`;
+      }
+      archetypeOptions.appendChild(option);
+    });
+  });
+}
+
+async function mergeArchetypes() {
+  const from = window.prompt("Archetype to merge away");
+  if (!from || !from.trim()) {
+    return;
+  }
+  const into = window.prompt(`Merge "${from.trim()}" into`);
+  if (!into || !into.trim()) {
+    return;
+  }
+  const result = await apiFetch("/api/archetypes/merge", {
+    method: "POST",
+    body: JSON.stringify({ from: from.trim(), into: into.trim() }),
+  });
+  deckNotice.textContent = `Merged "${from.trim()}" into ${result.archetype.name}; ${result.changed} battle(s) updated.`;
+  await loadArchetypes();
+  if (state.currentDeck) {
+    await loadDeck(state.currentDeck.name);
+  }
+}
+
 async function init() {
   setStatus("Connecting...");
   loadAppearanceSettings();
   await loadDecks();
+  await loadFormats();
+  await loadArchetypes();
   setStatus("Connected");
 }
 
@@ -443,6 +850,14 @@ document.getElementById("createDeckForm").addEventListener("submit", createDeck)
 document.getElementById("searchForm").addEventListener("submit", searchCards);
 document.getElementById("battleForm").addEventListener("submit", recordBattle);
 deckSelect.addEventListener("change", (event) => loadDeck(event.target.value));
+formatSelect.addEventListener("change", (event) => setFormat(event.target.value));
+document.getElementById("energyForm").addEventListener("submit", setEnergyTypes);
+document.getElementById("renameDeck").addEventListener("click", renameDeck);
+document.getElementById("duplicateDeck").addEventListener("click", duplicateDeck);
+document.getElementById("archiveDeck").addEventListener("click", () => retireDeck("archive"));
+document.getElementById("deleteDeck").addEventListener("click", () => retireDeck("delete"));
+document.getElementById("mergeArchetypes").addEventListener("click", mergeArchetypes);
+undoBattle.addEventListener("click", undoLastBattle);
 
 if (themeSelect) {
   themeSelect.addEventListener("change", (event) => {
@@ -452,6 +867,20 @@ if (themeSelect) {
   });
 }
 
+if (languageSelect) {
+  languageSelect.addEventListener("change", (event) => {
+    const language = event.target.value;
+    if (language) {
+      localStorage.setItem(LANG_KEY, language);
+    } else {
+      localStorage.removeItem(LANG_KEY);
+    }
+    if (state.currentDeck) {
+      loadDeck(state.currentDeck.name);
+    }
+  });
+}
+
 if (backgroundUpload) {
   backgroundUpload.addEventListener("change", (event) => {
     const file = event.target.files?.[0];
@@ -0,0 +1,246 @@
+package tcg
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ArchetypesFileName is the registry file kept in DecksDir. Its leading dot
+// keeps it out of ListExistingDecks.
+const ArchetypesFileName = ".archetypes.json"
+
+// Archetype is a named opponent deck. Aliases are other spellings that
+// should count as the same deck; KeyCards are card IDs that identify it.
+type Archetype struct {
+	Name     string   `json:"name"`
+	Aliases  []string `json:"aliases,omitempty"`
+	KeyCards []string `json:"key_cards,omitempty"`
+}
+
+// ArchetypeRegistry maps opponent names typed by players onto canonical
+// archetypes. Changes are kept in memory until Save.
+type ArchetypeRegistry struct {
+	path       string
+	archetypes []Archetype
+	pending    []func(*ArchetypeRegistry) error
+}
+
+// LoadArchetypes reads the registry at path. A missing file is an empty
+// registry.
+func LoadArchetypes(path string) (*ArchetypeRegistry, error) {
+	registry := &ArchetypeRegistry{path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return registry, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var file struct {
+		Archetypes []Archetype `json:"archetypes"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("archetypes %s: %w", path, err)
+	}
+	registry.archetypes = file.Archetypes
+	return registry, nil
+}
+
+// List returns the archetypes sorted by name.
+func (r *ArchetypeRegistry) List() []Archetype {
+	if r == nil {
+		return nil
+	}
+	archetypes := append([]Archetype(nil), r.archetypes...)
+	sort.Slice(archetypes, func(i, j int) bool {
+		return strings.ToLower(archetypes[i].Name) < strings.ToLower(archetypes[j].Name)
+	})
+	return archetypes
+}
+
+// Find looks an archetype up by name or alias, ignoring case, spacing and
+// punctuation.
+func (r *ArchetypeRegistry) Find(name string) (Archetype, bool) {
+	if idx := r.index(name); idx >= 0 {
+		return r.archetypes[idx], true
+	}
+	return Archetype{}, false
+}
+
+func (r *ArchetypeRegistry) index(name string) int {
+	if r == nil {
+		return -1
+	}
+	key := foldText(name)
+	if key == "" {
+		return -1
+	}
+	for idx, archetype := range r.archetypes {
+		if foldText(archetype.Name) == key {
+			return idx
+		}
+		for _, alias := range archetype.Aliases {
+			if foldText(alias) == key {
+				return idx
+			}
+		}
+	}
+	return -1
+}
+
+// Normalize returns the canonical name for an opponent, or the trimmed
+// input when no archetype matches.
+func (r *ArchetypeRegistry) Normalize(opponent string) string {
+	if archetype, ok := r.Find(opponent); ok {
+		return archetype.Name
+	}
+	return strings.TrimSpace(opponent)
+}
+
+// Suggest returns up to limit canonical names whose name or an alias starts
+// with or contains prefix, best matches first.
+func (r *ArchetypeRegistry) Suggest(prefix string, limit int) []string {
+	key := foldText(prefix)
+	var starts, contains []string
+	for _, archetype := range r.List() {
+		rank := 0
+		for _, name := range append([]string{archetype.Name}, archetype.Aliases...) {
+			folded := foldText(name)
+			switch {
+			case strings.HasPrefix(folded, key):
+				rank = 2
+			case rank == 0 && strings.Contains(folded, key):
+				rank = 1
+			}
+		}
+		switch rank {
+		case 2:
+			starts = append(starts, archetype.Name)
+		case 1:
+			contains = append(contains, archetype.Name)
+		}
+	}
+	suggestions := append(starts, contains...)
+	if limit > 0 && len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+	return suggestions
+}
+
+// Add registers an archetype, or merges its aliases and key cards into the
+// archetype it matches.
+func (r *ArchetypeRegistry) Add(archetype Archetype) error {
+	return r.apply(func(r *ArchetypeRegistry) error {
+		archetype.Name = strings.TrimSpace(archetype.Name)
+		if archetype.Name == "" {
+			return fmt.Errorf("archetype name is required")
+		}
+		idx := r.index(archetype.Name)
+		if idx < 0 {
+			r.archetypes = append(r.archetypes, Archetype{Name: archetype.Name})
+			idx = len(r.archetypes) - 1
+		}
+		existing := &r.archetypes[idx]
+		existing.Aliases = mergeNames(existing.Aliases, archetype.Aliases, existing.Name)
+		existing.KeyCards = mergeNames(existing.KeyCards, archetype.KeyCards, "")
+		return nil
+	})
+}
+
+// Merge folds archetype from into into: from's name and aliases become
+// aliases of into, and from is removed. Either may be a name not yet in the
+// registry.
+func (r *ArchetypeRegistry) Merge(from, into string) error {
+	return r.apply(func(r *ArchetypeRegistry) error {
+		from, into = strings.TrimSpace(from), strings.TrimSpace(into)
+		if from == "" || into == "" {
+			return fmt.Errorf("both archetype names are required")
+		}
+		if idx := r.index(from); idx >= 0 && idx == r.index(into) {
+			return nil
+		}
+		source := Archetype{Name: from}
+		if idx := r.index(from); idx >= 0 {
+			source = r.archetypes[idx]
+			r.archetypes = append(r.archetypes[:idx], r.archetypes[idx+1:]...)
+		}
+		idx := r.index(into)
+		if idx < 0 {
+			r.archetypes = append(r.archetypes, Archetype{Name: into})
+			idx = len(r.archetypes) - 1
+		}
+		target := &r.archetypes[idx]
+		target.Aliases = mergeNames(target.Aliases, append([]string{source.Name}, source.Aliases...), target.Name)
+		target.KeyCards = mergeNames(target.KeyCards, source.KeyCards, "")
+		return nil
+	})
+}
+
+// apply runs change now and remembers it, so Save can replay it on top of
+// whatever another process wrote in the meantime.
+func (r *ArchetypeRegistry) apply(change func(*ArchetypeRegistry) error) error {
+	if err := change(r); err != nil {
+		return err
+	}
+	r.pending = append(r.pending, change)
+	return nil
+}
+
+// Save writes pending changes, re-reading the file under its lock first.
+func (r *ArchetypeRegistry) Save() error {
+	if r == nil || len(r.pending) == 0 {
+		return nil
+	}
+	lock, err := LockDeckFile(r.path)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	current, err := LoadArchetypes(r.path)
+	if err != nil {
+		return err
+	}
+	for _, change := range r.pending {
+		if err := change(current); err != nil {
+			return err
+		}
+	}
+
+	data, err := json.MarshalIndent(map[string][]Archetype{"archetypes": current.List()}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(r.path), 0o755); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(r.path, append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	r.archetypes = current.archetypes
+	r.pending = nil
+	return nil
+}
+
+// mergeNames appends the new values that are not already present, skipping
+// anything equal to exclude.
+func mergeNames(existing, values []string, exclude string) []string {
+	seen := map[string]bool{foldText(exclude): exclude != ""}
+	for _, value := range existing {
+		seen[foldText(value)] = true
+	}
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" || seen[foldText(value)] {
+			continue
+		}
+		seen[foldText(value)] = true
+		existing = append(existing, value)
+	}
+	return existing
+}
@@ -0,0 +1,125 @@
+package tcg
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrBattleNotFound = errors.New("battle not found")
+
+type TurnOrder string
+
+const (
+	TurnFirst  TurnOrder = "first"
+	TurnSecond TurnOrder = "second"
+)
+
+type GameMode string
+
+const (
+	ModeRanked GameMode = "ranked"
+	ModeCasual GameMode = "casual"
+	ModeEvent  GameMode = "event"
+)
+
+// ParseTurnOrder accepts "first"/"second" and short forms like "1" or "2nd".
+// An empty value means the turn order was not recorded.
+func ParseTurnOrder(value string) (TurnOrder, error) {
+	switch normalizeKey(value) {
+	case "":
+		return "", nil
+	case "first", "1", "1st", "f", "going first":
+		return TurnFirst, nil
+	case "second", "2", "2nd", "s", "going second":
+		return TurnSecond, nil
+	}
+	return "", fmt.Errorf("invalid turn order %q", value)
+}
+
+// ParseGameMode accepts ranked, casual or event. An empty value means the
+// mode was not recorded.
+func ParseGameMode(value string) (GameMode, error) {
+	switch mode := GameMode(normalizeKey(value)); mode {
+	case "", ModeRanked, ModeCasual, ModeEvent:
+		return mode, nil
+	}
+	return "", fmt.Errorf("invalid game mode %q", value)
+}
+
+// ParseTags splits a comma separated tag list, dropping blanks and repeats.
+func ParseTags(value string) []string {
+	return normalizeTags(strings.Split(value, ","))
+}
+
+func normalizeTags(values []string) []string {
+	var tags []string
+	seen := make(map[string]bool)
+	for _, value := range values {
+		tag := strings.TrimSpace(value)
+		if tag == "" || seen[strings.ToLower(tag)] {
+			continue
+		}
+		seen[strings.ToLower(tag)] = true
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
+// legacyOpponentSeparators are the separators people used to pack details
+// into the old free-text opponent field, in the order they are tried.
+var legacyOpponentSeparators = []string{" — ", " - ", " | ", ": "}
+
+// splitLegacyOpponent splits an old opponent string such as
+// "Mewtwo ex — lost on time" into the opponent and the remaining details.
+func splitLegacyOpponent(opponent string) (string, string) {
+	opponent = strings.TrimSpace(opponent)
+	for _, separator := range legacyOpponentSeparators {
+		if name, details, ok := strings.Cut(opponent, separator); ok {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				name = "Unknown"
+			}
+			return name, strings.TrimSpace(details)
+		}
+	}
+	if opponent == "" {
+		opponent = "Unknown"
+	}
+	return opponent, ""
+}
+
+// newBattleID returns a random ID not used by any battle in the deck.
+func (d *Deck) newBattleID() string {
+	for {
+		var raw [6]byte
+		if _, err := rand.Read(raw[:]); err != nil {
+			panic(err)
+		}
+		if id := hex.EncodeToString(raw[:]); d.battleIndex(id) < 0 {
+			return id
+		}
+	}
+}
+
+// ensureBattleIDs gives battles saved before IDs existed, or sharing an ID
+// after a hand edit, an ID derived from their position and contents. The
+// result is the same on every load, so clients can refer to a battle before
+// the deck is saved again.
+func (d *Deck) ensureBattleIDs() {
+	seen := make(map[string]bool)
+	for idx := range d.BattleHistory {
+		battle := &d.BattleHistory[idx]
+		if battle.ID == "" || seen[battle.ID] {
+			battle.ID = ""
+			encoded, _ := json.Marshal(battle)
+			sum := sha256.Sum256(fmt.Appendf(encoded, "#%d", idx))
+			battle.ID = hex.EncodeToString(sum[:6])
+		}
+		seen[battle.ID] = true
+	}
+}
@@ -0,0 +1,255 @@
+package tcg
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+)
+
+const (
+	defaultCatalogTTL = 24 * time.Hour
+	cacheManifestName = "manifest.json"
+)
+
+// CatalogCache stores raw catalog responses on disk together with their HTTP
+// validators so later loads can skip the network or revalidate cheaply.
+type CatalogCache struct {
+	Dir string
+	TTL time.Duration
+}
+
+type cacheManifest struct {
+	Entries map[string]cacheEntry `json:"entries"`
+}
+
+type cacheEntry struct {
+	File         string    `json:"file"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	FetchedAt    time.Time `json:"fetched_at"`
+	ValidatedAt  time.Time `json:"validated_at"`
+}
+
+type cacheResult int
+
+const (
+	cacheMiss cacheResult = iota
+	cacheFresh
+	cacheRevalidated
+	cacheDownloaded
+	cacheStale
+)
+
+// DefaultCatalogCache returns the cache under the user's cache directory.
+// TCG_CACHE_DIR overrides the location and TCG_CATALOG_TTL the freshness window.
+func DefaultCatalogCache() *CatalogCache {
+	cache := &CatalogCache{TTL: defaultCatalogTTL}
+	if dir := strings.TrimSpace(os.Getenv("TCG_CACHE_DIR")); dir != "" {
+		cache.Dir = dir
+	} else if base, err := os.UserCacheDir(); err == nil {
+		cache.Dir = filepath.Join(base, "tcgcli", "catalog")
+	}
+	if value := strings.TrimSpace(os.Getenv("TCG_CATALOG_TTL")); value != "" {
+		if ttl, err := time.ParseDuration(value); err == nil {
+			cache.TTL = ttl
+		}
+	}
+	return cache
+}
+
+func (c *CatalogCache) enabled() bool {
+	return c != nil && c.Dir != ""
+}
+
+func (c *CatalogCache) readManifest() cacheManifest {
+	manifest := cacheManifest{Entries: make(map[string]cacheEntry)}
+	if !c.enabled() {
+		return manifest
+	}
+	data, err := os.ReadFile(filepath.Join(c.Dir, cacheManifestName))
+	if err != nil {
+		return manifest
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil || manifest.Entries == nil {
+		return cacheManifest{Entries: make(map[string]cacheEntry)}
+	}
+	return manifest
+}
+
+func (c *CatalogCache) writeManifest(manifest cacheManifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(c.Dir, cacheManifestName), data, 0o644)
+}
+
+func (c *CatalogCache) lookup(url string) (cacheEntry, []byte, bool) {
+	entry, ok := c.readManifest().Entries[url]
+	if !ok || entry.File == "" {
+		return cacheEntry{}, nil, false
+	}
+	body, err := os.ReadFile(filepath.Join(c.Dir, entry.File))
+	if err != nil {
+		return cacheEntry{}, nil, false
+	}
+	return entry, body, true
+}
+
+func (c *CatalogCache) store(url string, entry cacheEntry, body []byte) error {
+	if !c.enabled() {
+		return nil
+	}
+	if err := os.MkdirAll(c.Dir, 0o755); err != nil {
+		return err
+	}
+	if body != nil {
+		if err := writeFileAtomic(filepath.Join(c.Dir, entry.File), body, 0o644); err != nil {
+			return err
+		}
+	}
+	manifest := c.readManifest()
+	manifest.Entries[url] = entry
+	return c.writeManifest(manifest)
+}
+
+// fetch decodes the document at url into target, consulting the cache first.
+// When the network is unreachable but a cached copy exists, the cached copy is
+// decoded and reported as cacheStale together with the network error.
+func (c *CatalogCache) fetch(client *http.Client, url string, target interface{}) (cacheResult, error) {
+	var (
+		entry  cacheEntry
+		cached []byte
+		hit    bool
+	)
+	if c.enabled() {
+		entry, cached, hit = c.lookup(url)
+		if hit && decodeJSON(cached, target) != nil {
+			hit = false
+		}
+	}
+	if hit && c.TTL > 0 && time.Since(entry.ValidatedAt) < c.TTL {
+		return cacheFresh, nil
+	}
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return cacheMiss, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if hit {
+		if entry.ETag != "" {
+			req.Header.Set("If-None-Match", entry.ETag)
+		}
+		if entry.LastModified != "" {
+			req.Header.Set("If-Modified-Since", entry.LastModified)
+		}
+	}
+
+	stale := func(err error) (cacheResult, error) {
+		if hit {
+			return cacheStale, err
+		}
+		return cacheMiss, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return stale(err)
+	}
+	defer resp.Body.Close()
+
+	now := time.Now()
+	switch {
+	case resp.StatusCode == http.StatusNotModified && hit:
+		entry.ValidatedAt = now
+		_ = c.store(url, entry, nil)
+		return cacheRevalidated, nil
+	case resp.StatusCode == http.StatusOK:
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return stale(err)
+		}
+		if err := decodeJSON(body, target); err != nil {
+			if hit {
+				_ = decodeJSON(cached, target)
+			}
+			return stale(err)
+		}
+		_ = c.store(url, cacheEntry{
+			File:         cacheFileName(url),
+			ETag:         resp.Header.Get("ETag"),
+			LastModified: resp.Header.Get("Last-Modified"),
+			FetchedAt:    now,
+			ValidatedAt:  now,
+		}, body)
+		return cacheDownloaded, nil
+	default:
+		return stale(fmt.Errorf("unexpected status code %d", resp.StatusCode))
+	}
+}
+
+// cached decodes the stored copy of url into target without touching the network.
+func (c *CatalogCache) cached(url string, target interface{}) bool {
+	if !c.enabled() {
+		return false
+	}
+	_, body, ok := c.lookup(url)
+	return ok && decodeJSON(body, target) == nil
+}
+
+func cacheFileName(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return hex.EncodeToString(sum[:8]) + ".json"
+}
+
+// writeFileAtomic writes data to a synced temp file in the same directory and
+// renames it over path, so readers see either the old or the new contents.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmpName)
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmpName)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	if err := os.Chmod(tmpName, perm); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	if err := os.Rename(tmpName, path); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	return nil
+}
+
+func decodeJSON(data []byte, target interface{}) error {
+	if value := reflect.ValueOf(target); value.Kind() == reflect.Pointer && !value.IsNil() {
+		value.Elem().Set(reflect.Zero(value.Elem().Type()))
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(target)
+}
@@ -0,0 +1,114 @@
+package tcg
+
+import "strings"
+
+var energyAliases = map[string]EnergyType{
+	"grass":     EnergyGrass,
+	"g":         EnergyGrass,
+	"fire":      EnergyFire,
+	"r":         EnergyFire,
+	"water":     EnergyWater,
+	"w":         EnergyWater,
+	"lightning": EnergyLightning,
+	"electric":  EnergyLightning,
+	"l":         EnergyLightning,
+	"psychic":   EnergyPsychic,
+	"p":         EnergyPsychic,
+	"fighting":  EnergyFighting,
+	"f":         EnergyFighting,
+	"darkness":  EnergyDarkness,
+	"dark":      EnergyDarkness,
+	"d":         EnergyDarkness,
+	"metal":     EnergyMetal,
+	"steel":     EnergyMetal,
+	"m":         EnergyMetal,
+	"dragon":    EnergyDragon,
+	"colorless": EnergyColorless,
+	"normal":    EnergyColorless,
+	"c":         EnergyColorless,
+}
+
+// ParseEnergyType accepts full names ("Lightning"), common aliases
+// ("electric", "steel") and the single-letter codes used on card text.
+func ParseEnergyType(value string) (EnergyType, bool) {
+	energy, ok := energyAliases[normalizeKey(value)]
+	return energy, ok
+}
+
+func ParseCardType(value string) (CardType, bool) {
+	switch key := normalizeKey(strings.ReplaceAll(value, "é", "e")); key {
+	case "pokemon":
+		return CardTypePokemon, true
+	case "item", "trainer - item":
+		return CardTypeItem, true
+	case "supporter", "trainer - supporter":
+		return CardTypeSupporter, true
+	case "tool", "pokemon tool", "trainer - tool":
+		return CardTypeTool, true
+	}
+	return "", false
+}
+
+func ParseStage(value string) (Stage, bool) {
+	key := strings.NewReplacer(" ", "", "-", "", "_", "").Replace(normalizeKey(value))
+	switch key {
+	case "basic", "0":
+		return StageBasic, true
+	case "stage1", "1":
+		return StageOne, true
+	case "stage2", "2":
+		return StageTwo, true
+	}
+	return "", false
+}
+
+func (c Card) IsPokemon() bool {
+	return c.Type == CardTypePokemon
+}
+
+func (c Card) IsBasicPokemon() bool {
+	return c.Type == CardTypePokemon && c.Stage == StageBasic
+}
+
+// normalizeCard trims free-text fields and canonicalizes enum-like fields so
+// cards from every loader compare equal.
+func normalizeCard(card *Card) {
+	card.Name = strings.TrimSpace(card.Name)
+	card.Set = strings.TrimSpace(card.Set)
+	card.SetCode = strings.TrimSpace(card.SetCode)
+	if card.SetCode == "" {
+		card.SetCode = setCodeFromDisplay(card.Set)
+	}
+	card.ID = strings.TrimSpace(card.ID)
+	card.Rarity = strings.TrimSpace(card.Rarity)
+	card.EvolvesFrom = strings.TrimSpace(card.EvolvesFrom)
+
+	if cardType, ok := ParseCardType(string(card.Type)); ok {
+		card.Type = cardType
+	}
+	if stage, ok := ParseStage(string(card.Stage)); ok {
+		card.Stage = stage
+	}
+	if energy, ok := ParseEnergyType(string(card.Element)); ok {
+		card.Element = energy
+	}
+	if energy, ok := ParseEnergyType(string(card.Weakness)); ok {
+		card.Weakness = energy
+	}
+	for idx := range card.Attacks {
+		attack := &card.Attacks[idx]
+		attack.Name = strings.TrimSpace(attack.Name)
+		for costIdx, cost := range attack.Cost {
+			if energy, ok := ParseEnergyType(string(cost)); ok {
+				attack.Cost[costIdx] = energy
+			}
+		}
+	}
+
+	if card.Type == "" && (card.Element != "" || card.HP > 0 || card.Stage != "") {
+		card.Type = CardTypePokemon
+	}
+	if !card.Ex && strings.HasSuffix(strings.ToLower(card.Name), " ex") {
+		card.Ex = true
+	}
+}
@@ -3,55 +3,81 @@ package tcg
 import (
 	"encoding/json"
 	"fmt"
-	"net/http"
-	"os"
+	"io"
+	"strconv"
 	"strings"
-	"time"
 )
 
 const (
-	cardsURL = "https://raw.githubusercontent.com/flibustier/pokemon-tcg-pocket-database/main/dist/cards.json"
-	setsURL  = "https://raw.githubusercontent.com/flibustier/pokemon-tcg-pocket-database/main/dist/sets.json"
+	DefaultCardsURL = "https://raw.githubusercontent.com/flibustier/pokemon-tcg-pocket-database/main/dist/cards.json"
+	DefaultSetsURL  = "https://raw.githubusercontent.com/flibustier/pokemon-tcg-pocket-database/main/dist/sets.json"
 )
 
 type remoteCard struct {
-	Set    string            `json:"set"`
-	Number json.Number       `json:"number"`
-	Label  map[string]string `json:"label"`
+	Set         string            `json:"set"`
+	Number      json.Number       `json:"number"`
+	Label       map[string]string `json:"label"`
+	Rarity      string            `json:"rarity"`
+	Pack        string            `json:"pack"`
+	Packs       []string          `json:"packs"`
+	Type        string            `json:"type"`
+	Element     string            `json:"element"`
+	HP          flexString        `json:"hp"`
+	Stage       string            `json:"stage"`
+	EvolvesFrom string            `json:"evolvesFrom"`
+	Attacks     []remoteAttack    `json:"attacks"`
+	Retreat     flexString        `json:"retreat"`
+	Weakness    string            `json:"weakness"`
+	Ex          bool              `json:"ex"`
+}
+
+type remoteAttack struct {
+	Name   string     `json:"name"`
+	Cost   []string   `json:"cost"`
+	Damage flexString `json:"damage"`
+	Effect string     `json:"effect"`
 }
 
 type remoteSet struct {
-	Code  string            `json:"code"`
-	Label map[string]string `json:"label"`
+	Code        string            `json:"code"`
+	Label       map[string]string `json:"label"`
+	ReleaseDate string            `json:"releaseDate"`
+	Count       flexString        `json:"count"`
+	Packs       []string          `json:"packs"`
 }
 
 func LoadValidCards() ([]Card, CardsSource, error, error) {
-	cards, err := fetchRemoteCards()
-	if err == nil {
-		return cards, CardsSourceRemote, nil, nil
-	}
-
-	localCards, localErr := loadLocalCards()
-	if localErr != nil {
-		return nil, CardsSourceNone, nil, fmt.Errorf("remote error: %w; local error: %v", err, localErr)
+	load, err := DefaultCardSource().Load()
+	if err != nil {
+		return nil, CardsSourceNone, nil, err
 	}
-
-	return localCards, CardsSourceLocal, err, nil
+	return load.Cards, load.Source, load.Warning, nil
 }
 
-func fetchRemoteCards() ([]Card, error) {
-	client := &http.Client{Timeout: 15 * time.Second}
-
-	var rawCards []remoteCard
-	if err := fetchJSON(client, cardsURL, &rawCards); err != nil {
-		return nil, err
-	}
-
-	var rawSets []remoteSet
-	if err := fetchJSON(client, setsURL, &rawSets); err != nil {
-		return nil, err
+func buildRemoteSets(rawSets []remoteSet) []Set {
+	var sets []Set
+	for _, raw := range rawSets {
+		code := strings.TrimSpace(raw.Code)
+		if code == "" {
+			continue
+		}
+		releaseDate := strings.TrimSpace(raw.ReleaseDate)
+		if len(releaseDate) > len("2006-01-02") {
+			releaseDate = releaseDate[:len("2006-01-02")]
+		}
+		sets = append(sets, Set{
+			Code:        code,
+			Name:        pickLabel(raw.Label, code),
+			Names:       localizedLabels(raw.Label),
+			ReleaseDate: releaseDate,
+			Packs:       raw.Packs,
+			CardCount:   parseOptionalNumber(raw.Count),
+		})
 	}
+	return sets
+}
 
+func buildRemoteCards(rawCards []remoteCard, rawSets []remoteSet) []Card {
 	setMap := make(map[string]string)
 	for _, s := range rawSets {
 		if s.Code == "" {
@@ -82,69 +108,87 @@ func fetchRemoteCards() ([]Card, error) {
 			setName = setCode
 		}
 
-		cards = append(cards, Card{
-			Name: name,
-			Set:  fmt.Sprintf("%s (%s)", setName, setCode),
-			ID:   fmt.Sprintf("%s-%03d", strings.ToLower(setCode), number),
-		})
-	}
-
-	return cards, nil
-}
-
-func fetchJSON(client *http.Client, url string, target interface{}) error {
-	req, err := http.NewRequest(http.MethodGet, url, nil)
-	if err != nil {
-		return err
-	}
-	req.Header.Set("Accept", "application/json")
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+		card := Card{
+			Name:        name,
+			Names:       localizedLabels(raw.Label),
+			Set:         fmt.Sprintf("%s (%s)", setName, setCode),
+			SetCode:     setCode,
+			ID:          fmt.Sprintf("%s-%03d", strings.ToLower(setCode), number),
+			Rarity:      raw.Rarity,
+			Packs:       raw.Packs,
+			Type:        CardType(raw.Type),
+			Element:     EnergyType(raw.Element),
+			HP:          parseOptionalNumber(raw.HP),
+			Stage:       Stage(raw.Stage),
+			EvolvesFrom: raw.EvolvesFrom,
+			RetreatCost: parseOptionalNumber(raw.Retreat),
+			Weakness:    EnergyType(raw.Weakness),
+			Ex:          raw.Ex,
+		}
+		if len(card.Packs) == 0 && strings.TrimSpace(raw.Pack) != "" {
+			card.Packs = []string{strings.TrimSpace(raw.Pack)}
+		}
+		for _, attack := range raw.Attacks {
+			converted := Attack{
+				Name:   attack.Name,
+				Damage: string(attack.Damage),
+				Effect: strings.TrimSpace(attack.Effect),
+			}
+			for _, cost := range attack.Cost {
+				converted.Cost = append(converted.Cost, EnergyType(cost))
+			}
+			card.Attacks = append(card.Attacks, converted)
+		}
+		normalizeCard(&card)
+		cards = append(cards, card)
 	}
 
-	decoder := json.NewDecoder(resp.Body)
-	decoder.UseNumber()
-	return decoder.Decode(target)
+	return cards
 }
 
 func pickLabel(label map[string]string, fallback string) string {
-	if label == nil {
-		return fallback
-	}
-	if eng, ok := label["eng"]; ok && strings.TrimSpace(eng) != "" {
-		return eng
-	}
-	if en, ok := label["en"]; ok && strings.TrimSpace(en) != "" {
-		return en
+	if name := localizedLabels(label)[DefaultLocale]; name != "" {
+		return name
 	}
 	return fallback
 }
 
-func loadLocalCards() ([]Card, error) {
-	file, err := os.Open("valid_cards.json")
-	if err != nil {
-		return nil, err
-	}
-	defer file.Close()
-
+func decodeLocalCards(r io.Reader) ([]Card, error) {
 	var cards []Card
-	decoder := json.NewDecoder(file)
+	decoder := json.NewDecoder(r)
 	if err := decoder.Decode(&cards); err != nil {
 		return nil, err
 	}
 
 	for idx := range cards {
-		cards[idx].Name = strings.TrimSpace(cards[idx].Name)
-		cards[idx].Set = strings.TrimSpace(cards[idx].Set)
-		cards[idx].ID = strings.TrimSpace(cards[idx].ID)
+		normalizeCard(&cards[idx])
 	}
 
 	return cards, nil
 }
+
+func parseOptionalNumber(number flexString) int {
+	value, err := strconv.Atoi(strings.TrimSpace(string(number)))
+	if err != nil {
+		return 0
+	}
+	return value
+}
+
+// flexString decodes a JSON string or number, since the remote database is not
+// consistent about quoting values like HP or "30+" damage.
+type flexString string
+
+func (f *flexString) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*f = flexString(strings.TrimSpace(text))
+		return nil
+	}
+	var number json.Number
+	if err := json.Unmarshal(data, &number); err != nil {
+		return nil
+	}
+	*f = flexString(number.String())
+	return nil
+}
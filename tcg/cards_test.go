@@ -0,0 +1,60 @@
+package tcg
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// testdata/remote holds a small cards.json and sets.json with every field
+// remoteCard and remoteSet map, numbers written both as numbers and strings.
+// Replace them with a trimmed copy of DefaultCardsURL and DefaultSetsURL
+// whenever the upstream files change shape.
+func TestHTTPSourceDecodesRemotePayload(t *testing.T) {
+	server := httptest.NewServer(http.FileServer(http.Dir("testdata/remote")))
+	defer server.Close()
+
+	load, err := NewMirrorSource(server.URL, nil).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if load.Warning != nil {
+		t.Errorf("warning: %v", load.Warning)
+	}
+
+	wantSets := []Set{
+		{Code: "A1", Name: "Genetic Apex", Names: map[string]string{"en": "Genetic Apex"}, ReleaseDate: "2024-10-30", Packs: []string{"Mewtwo", "Charizard", "Pikachu"}, CardCount: 286},
+		{Code: "P-A", Name: "Promo-A", Names: map[string]string{"en": "Promo-A"}, ReleaseDate: "2024-10-30", CardCount: 24},
+	}
+	if !reflect.DeepEqual(load.Sets, wantSets) {
+		t.Errorf("sets:\n got %+v\nwant %+v", load.Sets, wantSets)
+	}
+
+	if len(load.Cards) != 3 {
+		t.Fatalf("got %d cards, want 3", len(load.Cards))
+	}
+	bulbasaur, ivysaur, potion := load.Cards[0], load.Cards[1], load.Cards[2]
+
+	if bulbasaur.ID != "a1-001" || bulbasaur.Set != "Genetic Apex (A1)" || bulbasaur.Names["fr"] != "Bulbizarre" {
+		t.Errorf("bulbasaur identity: %+v", bulbasaur)
+	}
+	if !bulbasaur.IsBasicPokemon() || bulbasaur.HP != 70 || bulbasaur.RetreatCost != 1 || bulbasaur.Element != EnergyGrass || bulbasaur.Weakness != EnergyFire {
+		t.Errorf("bulbasaur metadata: %+v", bulbasaur)
+	}
+	wantAttack := Attack{Name: "Vine Whip", Cost: []EnergyType{EnergyGrass, EnergyColorless}, Damage: "40"}
+	if len(bulbasaur.Attacks) != 1 || !reflect.DeepEqual(bulbasaur.Attacks[0], wantAttack) {
+		t.Errorf("bulbasaur attacks: %+v, want %+v", bulbasaur.Attacks, wantAttack)
+	}
+
+	if ivysaur.Stage != StageOne || ivysaur.EvolvesFrom != "Bulbasaur" || ivysaur.HP != 90 || ivysaur.RetreatCost != 2 {
+		t.Errorf("ivysaur metadata: %+v", ivysaur)
+	}
+	if !reflect.DeepEqual(ivysaur.Packs, []string{"Mewtwo"}) {
+		t.Errorf("ivysaur packs %v, want the single pack field", ivysaur.Packs)
+	}
+
+	if potion.Type != CardTypeItem || potion.ID != "p-a-001" || potion.Set != "Promo-A (P-A)" {
+		t.Errorf("potion: %+v", potion)
+	}
+}
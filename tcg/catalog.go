@@ -0,0 +1,281 @@
+package tcg
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Catalog is a read-only, indexed view of the valid card list. It is loaded
+// once and shared by every deck opened through a DeckManager. Cards are
+// returned with Name set in the catalog's locale; search matches every
+// language the catalog knows.
+type Catalog struct {
+	Source  CardsSource
+	Origin  string
+	Warning error
+
+	locale  string
+	locales []string
+	cards   []Card
+	sets    []Set
+	byID    map[string]int
+	byName  map[string][]int
+	bySet   map[string][]int
+	setIdx  map[string]int
+
+	metadata bool
+}
+
+func LoadCatalog() (*Catalog, error) {
+	return LoadCatalogFrom(DefaultCardSource())
+}
+
+func LoadCatalogFrom(source CardSource) (*Catalog, error) {
+	load, err := source.Load()
+	if err != nil {
+		return nil, err
+	}
+	catalog := NewCatalog(load.Cards, load.Sets)
+	catalog.Source = load.Source
+	catalog.Origin = load.Origin
+	catalog.Warning = load.Warning
+	return catalog, nil
+}
+
+// NewCatalog indexes cards. Sets may be nil, in which case the registry is
+// derived from the cards' set fields.
+func NewCatalog(cards []Card, sets []Set) *Catalog {
+	catalog := &Catalog{
+		locale: DefaultLocale,
+		cards:  append([]Card(nil), cards...),
+		byID:   make(map[string]int, len(cards)),
+		byName: make(map[string][]int),
+		bySet:  make(map[string][]int),
+		setIdx: make(map[string]int),
+	}
+	for idx := range catalog.cards {
+		normalizeCard(&catalog.cards[idx])
+		catalog.metadata = catalog.metadata || catalog.cards[idx].Type != ""
+	}
+	catalog.sets = buildSets(catalog.cards, sets)
+	seenLocales := map[string]bool{DefaultLocale: true}
+	for idx, set := range catalog.sets {
+		catalog.setIdx[normalizeKey(set.Code)] = idx
+		for locale := range set.Names {
+			seenLocales[locale] = true
+		}
+	}
+	for idx, card := range catalog.cards {
+		if id := normalizeKey(card.ID); id != "" {
+			if _, exists := catalog.byID[id]; !exists {
+				catalog.byID[id] = idx
+			}
+		}
+		names := map[string]bool{normalizeKey(card.Name): true}
+		for locale, name := range card.Names {
+			names[normalizeKey(name)] = true
+			seenLocales[locale] = true
+		}
+		for name := range names {
+			catalog.byName[name] = append(catalog.byName[name], idx)
+		}
+		set := normalizeKey(card.SetCode)
+		catalog.bySet[set] = append(catalog.bySet[set], idx)
+	}
+	for locale := range seenLocales {
+		catalog.locales = append(catalog.locales, locale)
+	}
+	sort.Strings(catalog.locales)
+	return catalog
+}
+
+// WithLocale returns a view of the catalog that displays names in locale. The
+// view shares the underlying index, so it is cheap to create per request.
+func (c *Catalog) WithLocale(locale string) *Catalog {
+	if c == nil {
+		return nil
+	}
+	view := *c
+	view.locale = NormalizeLocale(locale)
+	if view.locale == "" {
+		view.locale = DefaultLocale
+	}
+	return &view
+}
+
+func (c *Catalog) Locale() string {
+	if c == nil {
+		return DefaultLocale
+	}
+	return c.locale
+}
+
+// Locales lists the languages that at least one card has a name in.
+func (c *Catalog) Locales() []string {
+	if c == nil {
+		return []string{DefaultLocale}
+	}
+	return append([]string(nil), c.locales...)
+}
+
+// HasMetadata reports whether the cards carry type and stage data. Bare card
+// lists such as valid_cards.json only have names, sets and IDs.
+func (c *Catalog) HasMetadata() bool {
+	return c != nil && c.metadata
+}
+
+func (c *Catalog) Len() int {
+	if c == nil {
+		return 0
+	}
+	return len(c.cards)
+}
+
+func (c *Catalog) Cards() []Card {
+	if c == nil {
+		return nil
+	}
+	cards := make([]Card, len(c.cards))
+	for idx, card := range c.cards {
+		cards[idx] = c.localize(card)
+	}
+	return cards
+}
+
+func (c *Catalog) FindByID(cardID string) (Card, bool) {
+	card, ok := c.lookupID(cardID)
+	if !ok {
+		return Card{}, false
+	}
+	return c.localize(card), true
+}
+
+// lookupID returns the card with its canonical name, for storing in decks.
+func (c *Catalog) lookupID(cardID string) (Card, bool) {
+	if c == nil {
+		return Card{}, false
+	}
+	idx, ok := c.byID[normalizeKey(cardID)]
+	if !ok {
+		return Card{}, false
+	}
+	return c.cards[idx], true
+}
+
+func (c *Catalog) localize(card Card) Card {
+	if c.locale == DefaultLocale {
+		return card
+	}
+	card.Name = card.LocalizedName(c.locale)
+	if idx, ok := c.setIdx[normalizeKey(card.SetCode)]; ok {
+		if name := c.sets[idx].Names[c.locale]; name != "" {
+			card.Set = fmt.Sprintf("%s (%s)", name, c.sets[idx].Code)
+		}
+	}
+	return card
+}
+
+func (c *Catalog) FindByName(name string) []Card {
+	if c == nil {
+		return nil
+	}
+	return c.collect(c.byName[normalizeKey(name)])
+}
+
+// FindBySet returns the cards of a set given its code or display string.
+func (c *Catalog) FindBySet(set string) []Card {
+	if c == nil {
+		return nil
+	}
+	if matches, ok := c.bySet[normalizeKey(set)]; ok {
+		return c.collect(matches)
+	}
+	return c.collect(c.bySet[normalizeKey(setCodeFromDisplay(set))])
+}
+
+// Sets lists the set registry in release order, with names in the catalog's
+// locale.
+func (c *Catalog) Sets() []Set {
+	if c == nil {
+		return nil
+	}
+	sets := make([]Set, len(c.sets))
+	for idx, set := range c.sets {
+		set.Name = set.LocalizedName(c.locale)
+		sets[idx] = set
+	}
+	return sets
+}
+
+func (c *Catalog) FindSet(code string) (Set, bool) {
+	if c == nil {
+		return Set{}, false
+	}
+	idx, ok := c.setIdx[normalizeKey(code)]
+	if !ok {
+		return Set{}, false
+	}
+	set := c.sets[idx]
+	set.Name = set.LocalizedName(c.locale)
+	return set, true
+}
+
+// Search returns cards whose name, set or ID contains term, in catalog order.
+func (c *Catalog) Search(term string) []Card {
+	normalized := normalizeKey(term)
+	if c == nil || normalized == "" {
+		return nil
+	}
+
+	seen := make(map[int]bool)
+	var indexes []int
+	add := func(matches []int) {
+		for _, idx := range matches {
+			if !seen[idx] {
+				seen[idx] = true
+				indexes = append(indexes, idx)
+			}
+		}
+	}
+	for name, matches := range c.byName {
+		if strings.Contains(name, normalized) {
+			add(matches)
+		}
+	}
+	for _, set := range c.sets {
+		labels := []string{set.Code, set.Name}
+		for _, name := range set.Names {
+			labels = append(labels, name)
+		}
+		for _, label := range labels {
+			if strings.Contains(normalizeKey(label), normalized) {
+				add(c.bySet[normalizeKey(set.Code)])
+				break
+			}
+		}
+	}
+	for id, idx := range c.byID {
+		if strings.Contains(id, normalized) {
+			add([]int{idx})
+		}
+	}
+
+	sort.Ints(indexes)
+	return c.collect(indexes)
+}
+
+func (c *Catalog) collect(indexes []int) []Card {
+	if len(indexes) == 0 {
+		return nil
+	}
+	cards := make([]Card, 0, len(indexes))
+	for _, idx := range indexes {
+		cards = append(cards, c.localize(c.cards[idx]))
+	}
+	return cards
+}
+
+func normalizeKey(value string) string {
+	return strings.ToLower(strings.TrimSpace(value))
+}
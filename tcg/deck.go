@@ -1,46 +1,77 @@
 package tcg
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 )
 
 type Deck struct {
-	Name           string
-	FilePath       string
-	Cards          []CardEntry
-	BattleHistory  []BattleRecord
-	ValidCards     []Card
-	CardsSource    CardsSource
-	CardsLoadError error
-	LoadStatus     DeckLoadStatus
+	Name          string
+	FilePath      string
+	Cards         []CardEntry
+	BattleHistory []BattleRecord
+	Catalog       *Catalog
+	LoadStatus    DeckLoadStatus
+
+	// Format names the rules the deck is built for; empty means standard.
+	// Formats is where the name is looked up.
+	Format  string
+	Formats *FormatRegistry
+
+	// EnergyTypes are the types the deck's Energy Zone generates.
+	EnergyTypes []EnergyType
+
+	// Archetypes normalizes opponent names; new ones are registered when a
+	// battle is recorded and written out by Save.
+	Archetypes *ArchetypeRegistry
+
+	CardMigration CardMigration
+
+	// SchemaMigration is set when the file was upgraded from an older
+	// schema version while loading.
+	SchemaMigration *SchemaMigration
+
+	// LoadError is the decode error behind DeckLoadReset. The damaged file is
+	// copied to QuarantinePath and is only overwritten after ConfirmOverwrite.
+	LoadError          error
+	QuarantinePath     string
+	overwriteConfirmed bool
+
+	// diskSum is the hash of the file as it was read or last saved, empty
+	// when there was no file. Save compares it to catch edits made elsewhere.
+	diskSum string
+	lock    *DeckLock
 }
 
-func NewDeck(name, filePath string) (*Deck, error) {
+func NewDeck(name, filePath string, catalog *Catalog) (*Deck, error) {
+	return newDeck(name, filePath, catalog, nil)
+}
+
+// newDeck loads a deck whose file lock, if any, is already held, so that a
+// schema migration saved while loading does not wait on it.
+func newDeck(name, filePath string, catalog *Catalog, lock *DeckLock) (*Deck, error) {
 	deck := &Deck{
 		Name:     name,
 		FilePath: filePath,
+		Catalog:  catalog,
+		lock:     lock,
 	}
 
-	cards, source, warn, err := LoadValidCards()
-	if err != nil {
-		return nil, err
-	}
-	deck.ValidCards = cards
-	deck.CardsSource = source
-	deck.CardsLoadError = warn
-
 	status, err := deck.loadDeckFile()
 	if err != nil {
 		return nil, err
 	}
 	deck.LoadStatus = status
+	deck.CardMigration = deck.resolveCardIDs()
 
 	return deck, nil
 }
@@ -54,110 +85,197 @@ func (d *Deck) loadDeckFile() (DeckLoadStatus, error) {
 		return DeckLoadReset, err
 	}
 
-	file, err := os.Open(d.FilePath)
+	original, err := os.ReadFile(d.FilePath)
 	if err != nil {
 		return DeckLoadReset, err
 	}
-	defer file.Close()
+	d.diskSum = fileSum(original)
 
+	var doc deckDocument
+	if err := json.Unmarshal(original, &doc); err != nil {
+		return DeckLoadReset, d.recoverCorruptDeck(original, err)
+	}
+	if doc == nil {
+		return DeckLoadReset, d.recoverCorruptDeck(original, fmt.Errorf("%w: top level is null", errMalformedDeck))
+	}
+	from, err := upgradeDeckDocument(doc)
+	if errors.Is(err, errMalformedDeck) {
+		return DeckLoadReset, d.recoverCorruptDeck(original, err)
+	}
+	if err != nil {
+		return DeckLoadReset, fmt.Errorf("%s: %w", d.FilePath, err)
+	}
+
+	upgraded, err := json.Marshal(doc)
+	if err != nil {
+		return DeckLoadReset, err
+	}
 	var data deckFileData
-	decoder := json.NewDecoder(file)
-	if err := decoder.Decode(&data); err != nil {
-		d.Cards = []CardEntry{}
-		d.BattleHistory = []BattleRecord{}
-		return DeckLoadReset, nil
+	if err := json.Unmarshal(upgraded, &data); err != nil {
+		return DeckLoadReset, d.recoverCorruptDeck(original, err)
 	}
 
 	d.Cards = data.Cards
 	d.BattleHistory = data.BattleHistory
+	d.ensureBattleIDs()
+	if name := strings.TrimSpace(data.Name); name != "" {
+		d.Name = name
+	}
+	d.Format = strings.TrimSpace(data.Format)
+	for _, value := range data.EnergyTypes {
+		if energy, ok := ParseEnergyType(string(value)); ok && isZoneEnergy(energy) {
+			d.EnergyTypes = append(d.EnergyTypes, energy)
+		}
+	}
+
+	if from != CurrentDeckSchemaVersion {
+		backup, err := backupDeckFile(d.FilePath, from, original)
+		if err != nil {
+			return DeckLoadReset, fmt.Errorf("back up %s before migrating: %w", d.FilePath, err)
+		}
+		if err := d.Save(); err != nil {
+			return DeckLoadReset, err
+		}
+		d.SchemaMigration = &SchemaMigration{From: from, To: CurrentDeckSchemaVersion, BackupPath: backup}
+	}
 	return DeckLoadLoaded, nil
 }
 
-func (d *Deck) Save() error {
-	data := deckFileData{
+func (d *Deck) fileData() deckFileData {
+	return deckFileData{
+		SchemaVersion: CurrentDeckSchemaVersion,
+		Name:          d.Name,
+		Format:        d.Format,
+		EnergyTypes:   d.EnergyTypes,
 		Cards:         d.Cards,
 		BattleHistory: d.BattleHistory,
 	}
+}
+
+// Revision identifies the deck contents as they would be saved. It changes
+// whenever cards or battles change.
+func (d *Deck) Revision() string {
+	encoded, err := json.Marshal(d.fileData())
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:8])
+}
+
+// Save writes the deck file. A deck that no longer holds its lock, such as
+// one the CLI keeps open, takes it for the write and returns ErrDeckChanged
+// if the file was changed elsewhere since it was read, unless the overwrite
+// was confirmed.
+func (d *Deck) Save() error {
+	if d.LoadStatus == DeckLoadReset && !d.overwriteConfirmed {
+		return ErrUnconfirmedOverwrite
+	}
+	if d.lock == nil {
+		lock, err := LockDeckFile(d.FilePath)
+		if err != nil {
+			return err
+		}
+		defer lock.Unlock()
+	}
+	if !d.overwriteConfirmed {
+		if err := d.checkDiskSum(); err != nil {
+			return err
+		}
+	}
+	data := d.fileData()
 
 	if err := os.MkdirAll(filepath.Dir(d.FilePath), 0o755); err != nil {
 		return err
 	}
 
-	file, err := os.Create(d.FilePath)
+	encoded, err := json.MarshalIndent(&data, "", "  ")
 	if err != nil {
 		return err
 	}
-	defer file.Close()
+	encoded = append(encoded, '\n')
+	if err := writeFileAtomic(d.FilePath, encoded, 0o644); err != nil {
+		return err
+	}
+	d.diskSum = fileSum(encoded)
+	return d.Archetypes.Save()
+}
 
-	encoder := json.NewEncoder(file)
-	encoder.SetIndent("", "  ")
-	return encoder.Encode(&data)
+func (d *Deck) checkDiskSum() error {
+	sum := ""
+	if current, err := os.ReadFile(d.FilePath); err == nil {
+		sum = fileSum(current)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if sum != d.diskSum {
+		return fmt.Errorf("%s: %w", d.FilePath, ErrDeckChanged)
+	}
+	return nil
+}
+
+func fileSum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Close releases the deck file lock taken by DeckManager.
+func (d *Deck) Close() error {
+	err := d.lock.Unlock()
+	d.lock = nil
+	return err
 }
 
 func (d *Deck) ListAvailableCards() []Card {
-	return append([]Card(nil), d.ValidCards...)
+	return d.Catalog.Cards()
 }
 
 func (d *Deck) SearchCards(term string) []Card {
-	normalized := strings.ToLower(strings.TrimSpace(term))
-	if normalized == "" {
-		return nil
-	}
-
-	var matches []Card
-	for _, card := range d.ValidCards {
-		name := strings.ToLower(card.Name)
-		set := strings.ToLower(card.Set)
-		if strings.Contains(name, normalized) || strings.Contains(set, normalized) {
-			matches = append(matches, card)
-		}
-	}
-	return matches
+	return d.Catalog.Search(term)
 }
 
 func (d *Deck) FindCardByID(cardID string) (Card, bool) {
-	needle := strings.ToLower(strings.TrimSpace(cardID))
-	if needle == "" {
-		return Card{}, false
-	}
-	for _, card := range d.ValidCards {
-		if strings.EqualFold(card.ID, needle) {
-			return card, true
-		}
-	}
-	return Card{}, false
+	return d.Catalog.FindByID(cardID)
 }
 
 func (d *Deck) AddCardByID(cardID string) (AddCardResult, error) {
-	card, ok := d.FindCardByID(cardID)
+	canonical, ok := d.Catalog.lookupID(cardID)
 	if !ok {
 		return AddCardResult{}, fmt.Errorf("card ID %q not found", cardID)
 	}
+	card := d.Catalog.localize(canonical)
 
-	cardName := strings.TrimSpace(card.Name)
-	cardSet := strings.TrimSpace(card.Set)
-	totalCopies := d.totalCopies(cardName)
-	if totalCopies >= 2 {
+	format := d.ActiveFormat()
+	if err := format.Allows(canonical); err != nil {
+		return AddCardResult{Card: card}, err
+	}
+	limit := d.nameLimit(format, canonical)
+
+	totalCopies := d.totalCopies(canonical.Name)
+	if totalCopies >= limit {
 		return AddCardResult{
 			Card:        card,
 			Added:       false,
 			TotalCopies: totalCopies,
-			SetCopies:   d.setCopies(cardName, cardSet),
+			SetCopies:   d.printCopies(canonical),
+			Limit:       limit,
 		}, nil
 	}
 
 	for idx := range d.Cards {
 		entry := &d.Cards[idx]
-		if strings.EqualFold(entry.Name, cardName) && strings.EqualFold(entry.Set, cardSet) {
-			if entry.Count >= 2 {
+		if d.entryIsCard(*entry, canonical) {
+			if entry.Count >= limit {
 				return AddCardResult{
 					Card:        card,
 					Entry:       *entry,
 					Added:       false,
 					TotalCopies: totalCopies,
 					SetCopies:   entry.Count,
+					Limit:       limit,
 				}, nil
 			}
+			entry.ID = canonical.ID
 			entry.Count++
 			return AddCardResult{
 				Card:        card,
@@ -165,11 +283,12 @@ func (d *Deck) AddCardByID(cardID string) (AddCardResult, error) {
 				Added:       true,
 				TotalCopies: totalCopies + 1,
 				SetCopies:   entry.Count,
+				Limit:       limit,
 			}, nil
 		}
 	}
 
-	entry := CardEntry{Name: cardName, Set: cardSet, Count: 1}
+	entry := CardEntry{ID: canonical.ID, Name: canonical.Name, Set: canonical.Set, Count: 1}
 	d.Cards = append(d.Cards, entry)
 	return AddCardResult{
 		Card:        card,
@@ -177,6 +296,7 @@ func (d *Deck) AddCardByID(cardID string) (AddCardResult, error) {
 		Added:       true,
 		TotalCopies: totalCopies + 1,
 		SetCopies:   1,
+		Limit:       limit,
 	}, nil
 }
 
@@ -196,66 +316,245 @@ func (d *Deck) RemoveCard(index int) (CardEntry, error) {
 	return entry, nil
 }
 
-func (d *Deck) RecordBattle(result, opponent string, now time.Time) error {
-	outcome := strings.ToUpper(strings.TrimSpace(result))
-	if outcome != "W" && outcome != "L" {
-		return fmt.Errorf("invalid outcome %q", result)
+// RecordBattle validates record, stamps it with now and a new ID, and
+// appends it to the history. A record without a format gets the deck's
+// current format.
+func (d *Deck) RecordBattle(record BattleRecord, now time.Time) error {
+	record.ID = d.newBattleID()
+	record.Date = now.Truncate(time.Second)
+	if err := d.normalizeBattle(&record); err != nil {
+		return err
+	}
+	d.BattleHistory = append(d.BattleHistory, record)
+	return nil
+}
+
+// UpdateBattle replaces the battle with the given ID, keeping its ID and,
+// when record has none, its date.
+func (d *Deck) UpdateBattle(id string, record BattleRecord) error {
+	idx := d.battleIndex(id)
+	if idx < 0 {
+		return fmt.Errorf("%w: %s", ErrBattleNotFound, id)
 	}
+	record.ID = d.BattleHistory[idx].ID
+	if record.Date.IsZero() {
+		record.Date = d.BattleHistory[idx].Date
+	}
+	if err := d.normalizeBattle(&record); err != nil {
+		return err
+	}
+	d.BattleHistory[idx] = record
+	return nil
+}
 
-	record := BattleRecord{
-		Date:     now.Format("2006-01-02 15:04:05"),
-		Result:   outcome,
-		Opponent: strings.TrimSpace(opponent),
+// DeleteBattle removes the battle with the given ID and returns it.
+func (d *Deck) DeleteBattle(id string) (BattleRecord, error) {
+	idx := d.battleIndex(id)
+	if idx < 0 {
+		return BattleRecord{}, fmt.Errorf("%w: %s", ErrBattleNotFound, id)
 	}
-	if record.Opponent == "" {
-		record.Opponent = "Unknown"
+	record := d.BattleHistory[idx]
+	d.BattleHistory = append(d.BattleHistory[:idx], d.BattleHistory[idx+1:]...)
+	return record, nil
+}
+
+// Battle returns the battle with the given ID.
+func (d *Deck) Battle(id string) (BattleRecord, bool) {
+	if idx := d.battleIndex(id); idx >= 0 {
+		return d.BattleHistory[idx], true
 	}
+	return BattleRecord{}, false
+}
 
-	d.BattleHistory = append(d.BattleHistory, record)
+func (d *Deck) battleIndex(id string) int {
+	id = strings.TrimSpace(id)
+	for idx, battle := range d.BattleHistory {
+		if id != "" && battle.ID == id {
+			return idx
+		}
+	}
+	return -1
+}
+
+func (d *Deck) normalizeBattle(record *BattleRecord) error {
+	outcome, err := ParseOutcome(string(record.Result))
+	if err != nil {
+		return err
+	}
+	reason, err := ParseOutcomeReason(string(record.Reason))
+	if err != nil {
+		return err
+	}
+	if outcome == OutcomeTie && !reason.allowsTie() {
+		return fmt.Errorf("a game decided by %s cannot be a tie", strings.ReplaceAll(string(reason), "_", " "))
+	}
+	if record.Points < 0 || record.OpponentPoints < 0 || record.Turns < 0 {
+		return fmt.Errorf("points and turns cannot be negative")
+	}
+	turnOrder, err := ParseTurnOrder(string(record.TurnOrder))
+	if err != nil {
+		return err
+	}
+	mode, err := ParseGameMode(string(record.Mode))
+	if err != nil {
+		return err
+	}
+
+	record.Result = outcome
+	record.Reason = reason
+	record.Opponent = d.Archetypes.Normalize(record.Opponent)
+	if record.Opponent == "" || strings.EqualFold(record.Opponent, "Unknown") {
+		record.Opponent = "Unknown"
+	} else if _, known := d.Archetypes.Find(record.Opponent); !known && d.Archetypes != nil {
+		if err := d.Archetypes.Add(Archetype{Name: record.Opponent}); err != nil {
+			return err
+		}
+	}
+	record.OpponentPlayer = strings.TrimSpace(record.OpponentPlayer)
+	record.TurnOrder = turnOrder
+	record.Mode = mode
+	record.Format = strings.TrimSpace(record.Format)
+	if record.Format == "" {
+		record.Format = d.ActiveFormat().Name
+	}
+	record.Notes = strings.TrimSpace(record.Notes)
+	record.Tags = normalizeTags(record.Tags)
 	return nil
 }
 
 func (d *Deck) Stats() Stats {
+	return d.StatsFor(StatsQuery{}, DefaultStatsOptions())
+}
+
+// StatsFor aggregates the battles matching query, counting ties and
+// bucketing days as options says.
+func (d *Deck) StatsFor(query StatsQuery, options StatsOptions) Stats {
+	battles := d.filterBattles(query)
 	stats := Stats{
+		TieHandling:    options.Ties,
+		Reasons:        make(map[Outcome]map[OutcomeReason]int),
 		LossByOpponent: make(map[string]int),
 	}
-	stats.TotalBattles = len(d.BattleHistory)
+	if stats.TieHandling == "" {
+		stats.TieHandling = TiesExcluded
+	}
+	location := options.Location
+	if location == nil {
+		location = time.Local
+	}
+	stats.TimeZone = location.String()
+	stats.Matchups = []Matchup{}
+	stats.MatchupMinGames = max(options.MinMatchupGames, 1)
+	if !query.IsZero() {
+		stats.Query = &query
+	}
+	stats.TotalBattles = len(battles)
 	if stats.TotalBattles == 0 {
 		return stats
 	}
 
-	for _, battle := range d.BattleHistory {
-		switch {
-		case strings.EqualFold(battle.Result, "W"):
+	days := make(map[string]*DayStats)
+	opponents := make(map[string]*Matchup)
+	for _, battle := range battles {
+		outcome, err := ParseOutcome(string(battle.Result))
+		if err != nil {
+			continue
+		}
+		opponent := d.Archetypes.Normalize(battle.Opponent)
+		if opponent == "" {
+			opponent = "Unknown"
+		}
+		matchup := opponents[opponent]
+		if matchup == nil {
+			matchup = &Matchup{Opponent: opponent}
+			opponents[opponent] = matchup
+		}
+		day := &DayStats{}
+		if !battle.Date.IsZero() {
+			date := battle.Date.In(location).Format("2006-01-02")
+			if days[date] == nil {
+				days[date] = &DayStats{Date: date}
+			}
+			day = days[date]
+		}
+		switch outcome {
+		case OutcomeWin:
 			stats.Wins++
-		case strings.EqualFold(battle.Result, "L"):
-			stats.LossByOpponent[battle.Opponent]++
+			day.Wins++
+			matchup.Wins++
+		case OutcomeLoss:
+			stats.Losses++
+			day.Losses++
+			matchup.Losses++
+			stats.LossByOpponent[opponent]++
+		case OutcomeTie:
+			stats.Ties++
+			day.Ties++
+			matchup.Ties++
+		}
+		if battle.Reason != "" {
+			if stats.Reasons[outcome] == nil {
+				stats.Reasons[outcome] = make(map[OutcomeReason]int)
+			}
+			stats.Reasons[outcome][battle.Reason]++
 		}
 	}
-	stats.Losses = stats.TotalBattles - stats.Wins
-	stats.WinPercentage = (float64(stats.Wins) / float64(stats.TotalBattles)) * 100
+	for _, day := range days {
+		stats.Daily = append(stats.Daily, *day)
+	}
+	sort.Slice(stats.Daily, func(i, j int) bool { return stats.Daily[i].Date < stats.Daily[j].Date })
+	options.Ties = stats.TieHandling
+	stats.WinPercentage = options.winPercentage(stats.Wins, stats.Losses, stats.Ties)
+	stats.WinRate = options.estimate(stats.Wins, stats.Losses, stats.Ties)
+	stats.Matchups, stats.HiddenMatchups = options.matchups(opponents)
 	return stats
 }
 
 func (d *Deck) totalCopies(cardName string) int {
 	total := 0
 	for _, entry := range d.Cards {
-		if strings.EqualFold(entry.Name, cardName) {
+		if strings.EqualFold(d.entryName(entry), cardName) {
 			total += entry.Count
 		}
 	}
 	return total
 }
 
-func (d *Deck) setCopies(cardName, cardSet string) int {
+// nameLimit is the copy limit shared by every print with card's name: the
+// format's limit, lowered by any limited print of that name in the catalog.
+func (d *Deck) nameLimit(format Format, card Card) int {
+	limit := format.Limit(card)
+	for _, other := range d.Catalog.FindByName(card.Name) {
+		limit = min(limit, format.Limit(other))
+	}
+	return limit
+}
+
+func (d *Deck) printCopies(card Card) int {
 	for _, entry := range d.Cards {
-		if strings.EqualFold(entry.Name, cardName) && strings.EqualFold(entry.Set, cardSet) {
+		if d.entryIsCard(entry, card) {
 			return entry.Count
 		}
 	}
 	return 0
 }
 
+// entryName is the canonical name of the card an entry refers to. Entries
+// with a known ID follow the catalog, so renames don't split copy counts.
+func (d *Deck) entryName(entry CardEntry) string {
+	if card, ok := d.Catalog.lookupID(entry.ID); ok {
+		return card.Name
+	}
+	return entry.Name
+}
+
+func (d *Deck) entryIsCard(entry CardEntry, card Card) bool {
+	if entry.ID != "" {
+		return strings.EqualFold(entry.ID, card.ID)
+	}
+	return strings.EqualFold(entry.Name, card.Name) && strings.EqualFold(entry.Set, card.Set)
+}
+
 func parseRemoteCardNumber(number json.Number) (int, error) {
 	value := strings.TrimSpace(number.String())
 	if value == "" {
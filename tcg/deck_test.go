@@ -0,0 +1,49 @@
+package tcg
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSaveClosedDeckDetectsOtherWriters(t *testing.T) {
+	manager, err := NewDeckManager(t.TempDir(), NewCatalog(nil, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	created, err := manager.CreateDeck("Shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := created.Save(); err != nil {
+		t.Fatal(err)
+	}
+	created.Close()
+
+	// The CLI keeps its copy open without holding the lock.
+	cli, err := manager.LoadDeck("Shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cli.Close()
+	if err := cli.Save(); err != nil {
+		t.Fatalf("save without other writers: %v", err)
+	}
+
+	web, err := manager.LoadDeck("Shared")
+	if err != nil {
+		t.Fatalf("deck still locked after Close: %v", err)
+	}
+	web.Format = "other"
+	if err := web.Save(); err != nil {
+		t.Fatal(err)
+	}
+	web.Close()
+
+	if err := cli.Save(); !errors.Is(err, ErrDeckChanged) {
+		t.Fatalf("save over a concurrent edit: %v, want ErrDeckChanged", err)
+	}
+	cli.ConfirmOverwrite()
+	if err := cli.Save(); err != nil {
+		t.Fatalf("confirmed save: %v", err)
+	}
+}
@@ -0,0 +1,173 @@
+package tcg
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// zoneEnergyOrder lists the types the Energy Zone can generate, in the order
+// used to break ties between equally needed types.
+var zoneEnergyOrder = []EnergyType{
+	EnergyGrass,
+	EnergyFire,
+	EnergyWater,
+	EnergyLightning,
+	EnergyPsychic,
+	EnergyFighting,
+	EnergyDarkness,
+	EnergyMetal,
+}
+
+func isZoneEnergy(energy EnergyType) bool {
+	for _, zone := range zoneEnergyOrder {
+		if zone == energy {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseEnergyTypes parses a comma or space separated list such as
+// "fire, water" or "R W".
+func ParseEnergyTypes(value string) ([]EnergyType, error) {
+	var types []EnergyType
+	for _, field := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' || r == '/' }) {
+		energy, ok := ParseEnergyType(field)
+		if !ok {
+			return nil, fmt.Errorf("unknown energy type %q", field)
+		}
+		types = append(types, energy)
+	}
+	return types, nil
+}
+
+// SetEnergyTypes declares the types the deck's Energy Zone generates.
+// Duplicates are dropped; Colorless and Dragon cannot be generated.
+func (d *Deck) SetEnergyTypes(types []EnergyType) error {
+	var declared []EnergyType
+	seen := make(map[EnergyType]bool)
+	for _, energy := range types {
+		if !isZoneEnergy(energy) {
+			return fmt.Errorf("%s energy cannot be generated by the Energy Zone", energy)
+		}
+		if seen[energy] {
+			continue
+		}
+		seen[energy] = true
+		declared = append(declared, energy)
+	}
+	if len(declared) > MaxEnergyTypes {
+		return fmt.Errorf("a deck can declare at most %d energy types, got %d", MaxEnergyTypes, len(declared))
+	}
+	d.EnergyTypes = declared
+	return nil
+}
+
+// SuggestEnergyTypes proposes up to MaxEnergyTypes types for the deck, ranked
+// by how much typed energy its Pokémon's attacks need. Pokémon without attack
+// data count towards their own type.
+func (d *Deck) SuggestEnergyTypes() []EnergyType {
+	needed := make(map[EnergyType]int)
+	for _, entry := range d.Cards {
+		card, ok := d.Catalog.lookupID(entry.ID)
+		if !ok || !card.IsPokemon() {
+			continue
+		}
+		counted := false
+		for _, attack := range card.Attacks {
+			for _, cost := range attack.Cost {
+				if isZoneEnergy(cost) {
+					needed[cost] += entry.Count
+					counted = true
+				}
+			}
+		}
+		if !counted && isZoneEnergy(card.Element) {
+			needed[card.Element] += entry.Count
+		}
+	}
+
+	suggested := make([]EnergyType, 0, len(needed))
+	for _, energy := range zoneEnergyOrder {
+		if needed[energy] > 0 {
+			suggested = append(suggested, energy)
+		}
+	}
+	sort.SliceStable(suggested, func(i, j int) bool {
+		return needed[suggested[i]] > needed[suggested[j]]
+	})
+	if len(suggested) > MaxEnergyTypes {
+		suggested = suggested[:MaxEnergyTypes]
+	}
+	return suggested
+}
+
+// validateEnergy checks the deck's attacks against its declared Energy Zone
+// types, or suggests types when none are declared.
+func (d *Deck) validateEnergy(cards []Card, add func(IssueSeverity, string, string, ...string)) {
+	needsTyped := false
+	for _, card := range cards {
+		for _, attack := range card.Attacks {
+			for _, cost := range attack.Cost {
+				if isZoneEnergy(cost) {
+					needsTyped = true
+				}
+			}
+		}
+	}
+
+	if len(d.EnergyTypes) == 0 {
+		if !needsTyped {
+			return
+		}
+		message := "No energy types declared for the Energy Zone."
+		if suggested := d.SuggestEnergyTypes(); len(suggested) > 0 {
+			message += fmt.Sprintf(" Suggested: %s.", joinEnergyTypes(suggested))
+		}
+		add(IssueWarning, "energy_types", message)
+		return
+	}
+
+	declared := make(map[EnergyType]bool)
+	for _, energy := range d.EnergyTypes {
+		declared[energy] = true
+	}
+	reported := make(map[string]bool)
+	for _, card := range cards {
+		for _, attack := range card.Attacks {
+			var missing []EnergyType
+			for _, cost := range attack.Cost {
+				if isZoneEnergy(cost) && !declared[cost] {
+					missing = append(missing, cost)
+				}
+			}
+			key := card.ID + "/" + attack.Name
+			if len(missing) == 0 || reported[key] {
+				continue
+			}
+			reported[key] = true
+			add(IssueWarning, "unpayable_attack", fmt.Sprintf("%s's %s needs %s energy, which the Energy Zone (%s) does not generate.", card.Name, attack.Name, joinEnergyTypes(uniqueEnergyTypes(missing)), joinEnergyTypes(d.EnergyTypes)), card.ID)
+		}
+	}
+}
+
+func uniqueEnergyTypes(types []EnergyType) []EnergyType {
+	var unique []EnergyType
+	seen := make(map[EnergyType]bool)
+	for _, energy := range types {
+		if !seen[energy] {
+			seen[energy] = true
+			unique = append(unique, energy)
+		}
+	}
+	return unique
+}
+
+func joinEnergyTypes(types []EnergyType) string {
+	names := make([]string, len(types))
+	for idx, energy := range types {
+		names[idx] = string(energy)
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,150 @@
+package tcg
+
+import (
+	"fmt"
+	"math"
+)
+
+// DefaultSmallSampleGames is the number of games below which a win rate is
+// flagged as a small sample, unless TCG_SMALL_SAMPLE_GAMES says otherwise.
+const DefaultSmallSampleGames = 20
+
+// z95 is the standard normal quantile for a two-sided 95% interval.
+const z95 = 1.959963984540054
+
+// WinRateEstimate is a win rate with its 95% Wilson score interval, all in
+// percent. Games is the number of games the rate is out of, after tie
+// handling. Posterior is set when StatsOptions.Posterior asks for it.
+type WinRateEstimate struct {
+	Rate        float64        `json:"rate"`
+	Low         float64        `json:"low"`
+	High        float64        `json:"high"`
+	Games       int            `json:"games"`
+	SmallSample bool           `json:"smallSample"`
+	Posterior   *BetaPosterior `json:"posterior,omitempty"`
+}
+
+// BetaPosterior is the Beta(Alpha, Beta) posterior of the win rate under a
+// uniform prior, with its mean and 95% equal-tailed credible interval in
+// percent.
+type BetaPosterior struct {
+	Alpha float64 `json:"alpha"`
+	Beta  float64 `json:"beta"`
+	Mean  float64 `json:"mean"`
+	Low   float64 `json:"low"`
+	High  float64 `json:"high"`
+}
+
+// String formats the estimate as "58% (49–66%)", or "n/a" without games.
+func (e WinRateEstimate) String() string {
+	if e.Games == 0 {
+		return "n/a"
+	}
+	return fmt.Sprintf("%.0f%% (%.0f–%.0f%%)", e.Rate, e.Low, e.High)
+}
+
+// wilsonInterval returns the 95% Wilson score interval for wins successes
+// out of games, as fractions.
+func wilsonInterval(wins float64, games int) (float64, float64) {
+	if games == 0 {
+		return 0, 1
+	}
+	n := float64(games)
+	p := wins / n
+	z2 := z95 * z95
+	denominator := 1 + z2/n
+	center := (p + z2/(2*n)) / denominator
+	half := z95 * math.Sqrt(p*(1-p)/n+z2/(4*n*n)) / denominator
+	return math.Max(0, center-half), math.Min(1, center+half)
+}
+
+func betaPosterior(wins float64, games int) *BetaPosterior {
+	alpha, beta := wins+1, float64(games)-wins+1
+	return &BetaPosterior{
+		Alpha: alpha,
+		Beta:  beta,
+		Mean:  alpha / (alpha + beta) * 100,
+		Low:   betaQuantile(0.025, alpha, beta) * 100,
+		High:  betaQuantile(0.975, alpha, beta) * 100,
+	}
+}
+
+// betaQuantile inverts the regularized incomplete beta function by
+// bisection; 60 halvings are well past float64 precision on [0, 1].
+func betaQuantile(q, a, b float64) float64 {
+	low, high := 0.0, 1.0
+	for i := 0; i < 60; i++ {
+		mid := (low + high) / 2
+		if incompleteBeta(mid, a, b) < q {
+			low = mid
+		} else {
+			high = mid
+		}
+	}
+	return (low + high) / 2
+}
+
+// incompleteBeta is the regularized incomplete beta function I_x(a, b),
+// evaluated with the continued fraction from Numerical Recipes.
+func incompleteBeta(x, a, b float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	if x >= 1 {
+		return 1
+	}
+	lgab, _ := math.Lgamma(a + b)
+	lga, _ := math.Lgamma(a)
+	lgb, _ := math.Lgamma(b)
+	front := math.Exp(lgab - lga - lgb + a*math.Log(x) + b*math.Log(1-x))
+	if x < (a+1)/(a+b+2) {
+		return front * betaContinuedFraction(x, a, b) / a
+	}
+	return 1 - front*betaContinuedFraction(1-x, b, a)/b
+}
+
+func betaContinuedFraction(x, a, b float64) float64 {
+	const (
+		maxIterations = 200
+		epsilon       = 1e-14
+		tiny          = 1e-300
+	)
+	qab, qap, qam := a+b, a+1, a-1
+	c, d := 1.0, 1-qab*x/qap
+	if math.Abs(d) < tiny {
+		d = tiny
+	}
+	d = 1 / d
+	h := d
+	for m := 1; m <= maxIterations; m++ {
+		m2 := float64(2 * m)
+		fm := float64(m)
+		aa := fm * (b - fm) * x / ((qam + m2) * (a + m2))
+		d = 1 + aa*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + aa/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		h *= d * c
+		aa = -(a + fm) * (qab + fm) * x / ((a + m2) * (qap + m2))
+		d = 1 + aa*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + aa/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		delta := d * c
+		h *= delta
+		if math.Abs(delta-1) < epsilon {
+			break
+		}
+	}
+	return h
+}
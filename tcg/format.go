@@ -0,0 +1,204 @@
+package tcg
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// StandardFormatName is the built-in format used by decks without one.
+const StandardFormatName = "standard"
+
+var ErrCardNotAllowed = errors.New("card not allowed in format")
+
+//go:embed formats/*.json
+var builtinFormats embed.FS
+
+// Format is a set of deck building rules. Formats other than standard are
+// JSON files, built in from tcg/formats or read from the formats directory;
+// fields left out of a file keep the standard value.
+type Format struct {
+	Name         string         `json:"name"`
+	Description  string         `json:"description,omitempty"`
+	DeckSize     int            `json:"deck_size"`
+	CopyLimit    int            `json:"copy_limit"`
+	AllowedSets  []string       `json:"allowed_sets,omitempty"`
+	BannedCards  []string       `json:"banned_cards,omitempty"`
+	LimitedCards map[string]int `json:"limited_cards,omitempty"`
+	ExAllowed    *bool          `json:"ex_allowed,omitempty"`
+}
+
+// StandardFormat returns the standard Pocket rules.
+func StandardFormat() Format {
+	exAllowed := true
+	return Format{
+		Name:        StandardFormatName,
+		Description: "Standard Pokémon TCG Pocket rules",
+		DeckSize:    DeckSize,
+		CopyLimit:   MaxCopies,
+		ExAllowed:   &exAllowed,
+	}
+}
+
+// AllowsEx reports whether ex Pokémon may be played.
+func (f Format) AllowsEx() bool {
+	return f.ExAllowed == nil || *f.ExAllowed
+}
+
+// Limit returns how many copies of card a deck may hold in this format.
+func (f Format) Limit(card Card) int {
+	copies := f.CopyLimit
+	for id, limit := range f.LimitedCards {
+		if strings.EqualFold(id, card.ID) && limit < copies {
+			copies = limit
+		}
+	}
+	return copies
+}
+
+// Allows reports whether card may be played at all, and why not.
+func (f Format) Allows(card Card) error {
+	if reason := f.disallowed(card); reason != "" {
+		return fmt.Errorf("%w: %s", ErrCardNotAllowed, reason)
+	}
+	return nil
+}
+
+func (f Format) disallowed(card Card) string {
+	for _, id := range f.BannedCards {
+		if strings.EqualFold(id, card.ID) {
+			return fmt.Sprintf("%s (%s) is banned in %s", card.Name, card.ID, f.Name)
+		}
+	}
+	if card.Ex && !f.AllowsEx() {
+		return fmt.Sprintf("ex Pokémon such as %s are not allowed in %s", card.Name, f.Name)
+	}
+	if len(f.AllowedSets) > 0 {
+		for _, set := range f.AllowedSets {
+			if strings.EqualFold(set, card.SetCode) {
+				return ""
+			}
+		}
+		return fmt.Sprintf("%s is from %s, which is not allowed in %s", card.Name, card.SetCode, f.Name)
+	}
+	return ""
+}
+
+// FormatRegistry holds the formats a deck can be assigned to.
+type FormatRegistry struct {
+	formats map[string]Format
+}
+
+// DefaultFormatsDir is where extra format files are read from, overridable
+// with TCG_FORMATS_DIR.
+func DefaultFormatsDir() string {
+	return envOr("TCG_FORMATS_DIR", "formats")
+}
+
+// LoadFormats returns the standard format, the built-in formats and every
+// *.json file in dir. A file in dir replaces a built-in format of the same
+// name; a missing directory only leaves the built-in ones.
+func LoadFormats(dir string) (*FormatRegistry, error) {
+	registry := &FormatRegistry{formats: map[string]Format{StandardFormatName: StandardFormat()}}
+	if err := registry.loadFiles(builtinFormats, "formats/*.json"); err != nil {
+		return nil, err
+	}
+	if err := registry.loadFiles(os.DirFS(dir), "*.json"); err != nil {
+		return nil, fmt.Errorf("%s: %w", dir, err)
+	}
+	return registry, nil
+}
+
+func (r *FormatRegistry) loadFiles(fsys fs.FS, pattern string) error {
+	paths, err := fs.Glob(fsys, pattern)
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		format, err := readFormatFile(fsys, path)
+		if err != nil {
+			return fmt.Errorf("format %s: %w", path, err)
+		}
+		r.formats[normalizeKey(format.Name)] = format
+	}
+	return nil
+}
+
+func readFormatFile(fsys fs.FS, path string) (Format, error) {
+	data, err := fs.ReadFile(fsys, path)
+	if err != nil {
+		return Format{}, err
+	}
+	format := StandardFormat()
+	format.Name = ""
+	format.Description = ""
+	if err := json.Unmarshal(data, &format); err != nil {
+		return Format{}, err
+	}
+	format.Name = strings.TrimSpace(format.Name)
+	if format.Name == "" {
+		format.Name = strings.TrimSuffix(filepath.Base(path), ".json")
+	}
+	if format.DeckSize <= 0 || format.CopyLimit <= 0 {
+		return Format{}, fmt.Errorf("deck_size and copy_limit must be positive")
+	}
+	return format, nil
+}
+
+// Find looks a format up by name, ignoring case. An empty name is standard.
+func (r *FormatRegistry) Find(name string) (Format, bool) {
+	if strings.TrimSpace(name) == "" {
+		return StandardFormat(), true
+	}
+	if r == nil {
+		return StandardFormat(), normalizeKey(name) == StandardFormatName
+	}
+	format, ok := r.formats[normalizeKey(name)]
+	return format, ok
+}
+
+// List returns the formats sorted by name, standard first.
+func (r *FormatRegistry) List() []Format {
+	if r == nil {
+		return []Format{StandardFormat()}
+	}
+	formats := make([]Format, 0, len(r.formats))
+	for _, format := range r.formats {
+		formats = append(formats, format)
+	}
+	sort.Slice(formats, func(i, j int) bool {
+		if (formats[i].Name == StandardFormatName) != (formats[j].Name == StandardFormatName) {
+			return formats[i].Name == StandardFormatName
+		}
+		return strings.ToLower(formats[i].Name) < strings.ToLower(formats[j].Name)
+	})
+	return formats
+}
+
+// ActiveFormat returns the deck's format, falling back to standard when the
+// deck names a format that is not available.
+func (d *Deck) ActiveFormat() Format {
+	if format, ok := d.Formats.Find(d.Format); ok {
+		return format
+	}
+	return StandardFormat()
+}
+
+// SetFormat assigns the deck to a known format.
+func (d *Deck) SetFormat(name string) error {
+	format, ok := d.Formats.Find(name)
+	if !ok {
+		return fmt.Errorf("unknown format %q", name)
+	}
+	d.Format = format.Name
+	if format.Name == StandardFormatName {
+		d.Format = ""
+	}
+	return nil
+}
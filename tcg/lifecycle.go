@@ -0,0 +1,164 @@
+package tcg
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// TrashDirName and ArchiveDirName are subdirectories of DecksDir that
+	// ListExistingDecks does not look into.
+	TrashDirName   = ".trash"
+	ArchiveDirName = "archive"
+)
+
+// RenameDeck gives a deck a new display name, moving it to the matching
+// filename. The returned deck holds the lock on its new file.
+func (m *DeckManager) RenameDeck(name, newName string) (*Deck, error) {
+	newName, err := ValidateDeckName(newName)
+	if err != nil {
+		return nil, err
+	}
+	deck, err := m.LoadDeck(name)
+	if err != nil {
+		return nil, err
+	}
+	if newName == deck.Name {
+		return deck, nil
+	}
+	if other, found, err := m.findDeckFile(newName); err != nil {
+		deck.Close()
+		return nil, err
+	} else if found && other.path != deck.FilePath {
+		deck.Close()
+		return nil, os.ErrExist
+	}
+
+	oldPath := deck.FilePath
+	newPath := oldPath
+	if DeckSlug(newName) != DeckSlug(deck.Name) {
+		if newPath, err = m.newDeckPath(newName); err != nil {
+			deck.Close()
+			return nil, err
+		}
+	}
+	if newPath == oldPath {
+		deck.Name = newName
+		if err := deck.Save(); err != nil {
+			deck.Close()
+			return nil, err
+		}
+		return deck, nil
+	}
+
+	lock, err := LockDeckFile(newPath)
+	if err != nil {
+		deck.Close()
+		return nil, err
+	}
+	deck.Name = newName
+	deck.FilePath = newPath
+	deck.diskSum = ""
+	if err := deck.Save(); err != nil {
+		lock.Unlock()
+		deck.Close()
+		return nil, err
+	}
+	if err := os.Remove(oldPath); err != nil {
+		lock.Unlock()
+		deck.Close()
+		return nil, err
+	}
+	deck.Close()
+	deck.lock = lock
+	return deck, nil
+}
+
+// DuplicateDeck copies a deck's cards under a new name, with or without its
+// battle history. The returned copy holds the lock on its file.
+func (m *DeckManager) DuplicateDeck(name, newName string, keepHistory bool) (*Deck, error) {
+	source, err := m.LoadDeck(name)
+	if err != nil {
+		return nil, err
+	}
+	defer source.Close()
+
+	deck, err := m.CreateDeck(newName)
+	if err != nil {
+		return nil, err
+	}
+	deck.copyFrom(source, keepHistory)
+	if err := deck.Save(); err != nil {
+		deck.Close()
+		return nil, err
+	}
+	return deck, nil
+}
+
+// DeleteDeck moves a deck file into the trash folder rather than removing it.
+func (m *DeckManager) DeleteDeck(name string) error {
+	return m.moveDeck(name, TrashDirName, true)
+}
+
+// ArchiveDeck moves a deck file into the archive folder so it no longer shows
+// up in ListExistingDecks.
+func (m *DeckManager) ArchiveDeck(name string) error {
+	return m.moveDeck(name, ArchiveDirName, false)
+}
+
+func (m *DeckManager) moveDeck(name, dir string, stamp bool) error {
+	name, err := ValidateDeckName(name)
+	if err != nil {
+		return err
+	}
+	file, found, err := m.findDeckFile(name)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("deck %q: %w", name, os.ErrNotExist)
+	}
+	lock, err := LockDeckFile(file.path)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	targetDir := filepath.Join(m.DecksDir, dir)
+	if err := os.MkdirAll(targetDir, 0o755); err != nil {
+		return err
+	}
+	stem := strings.TrimSuffix(filepath.Base(file.path), ".json")
+	if stamp {
+		stem += "." + time.Now().Format("20060102T150405")
+	}
+	target := filepath.Join(targetDir, stem+".json")
+	for suffix := 2; ; suffix++ {
+		if _, err := os.Stat(target); errors.Is(err, os.ErrNotExist) {
+			break
+		} else if err != nil {
+			return err
+		}
+		target = filepath.Join(targetDir, fmt.Sprintf("%s-%d.json", stem, suffix))
+	}
+	if err := os.Rename(file.path, target); err != nil {
+		return err
+	}
+	return nil
+}
+
+// copyFrom copies the contents of src that belong to a deck list, leaving
+// d's name and file alone.
+func (d *Deck) copyFrom(src *Deck, keepHistory bool) {
+	d.Cards = append([]CardEntry(nil), src.Cards...)
+	d.Format = src.Format
+	d.EnergyTypes = append([]EnergyType(nil), src.EnergyTypes...)
+	d.BattleHistory = []BattleRecord{}
+	if keepHistory {
+		d.BattleHistory = append(d.BattleHistory, src.BattleHistory...)
+	}
+}
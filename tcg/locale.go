@@ -0,0 +1,131 @@
+package tcg
+
+import (
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultLocale is the language card names are stored and compared in.
+const DefaultLocale = "en"
+
+var localeAliases = map[string]string{
+	"eng": "en",
+	"fra": "fr",
+	"fre": "fr",
+	"deu": "de",
+	"ger": "de",
+	"jpn": "ja",
+	"jp":  "ja",
+	"ita": "it",
+	"spa": "es",
+	"por": "pt",
+	"kor": "ko",
+	"kr":  "ko",
+	"zho": "zh",
+	"chi": "zh",
+	"cn":  "zh",
+}
+
+// NormalizeLocale reduces values like "fr-FR", "fr_FR.UTF-8" or "fra" to a
+// two-letter language code. It returns "" for values that are not locales.
+func NormalizeLocale(value string) string {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if idx := strings.IndexAny(value, ".@"); idx >= 0 {
+		value = value[:idx]
+	}
+	if idx := strings.IndexAny(value, "-_"); idx >= 0 {
+		value = value[:idx]
+	}
+	if alias, ok := localeAliases[value]; ok {
+		return alias
+	}
+	if len(value) != 2 || value == "c" {
+		return ""
+	}
+	for _, r := range value {
+		if r < 'a' || r > 'z' {
+			return ""
+		}
+	}
+	return value
+}
+
+// LocaleFromEnv returns the locale from TCG_LOCALE, falling back to LANG and
+// then DefaultLocale.
+func LocaleFromEnv() string {
+	for _, key := range []string{"TCG_LOCALE", "LC_ALL", "LANG"} {
+		if locale := NormalizeLocale(os.Getenv(key)); locale != "" {
+			return locale
+		}
+	}
+	return DefaultLocale
+}
+
+// MatchAcceptLanguage picks the best of the supported locales for an HTTP
+// Accept-Language header value. It returns "" when nothing matches.
+func MatchAcceptLanguage(header string, supported []string) string {
+	type candidate struct {
+		locale string
+		weight float64
+	}
+	var candidates []candidate
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		locale := NormalizeLocale(fields[0])
+		if locale == "" {
+			continue
+		}
+		weight := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if value, ok := strings.CutPrefix(param, "q="); ok {
+				if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+					weight = parsed
+				}
+			}
+		}
+		candidates = append(candidates, candidate{locale: locale, weight: weight})
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].weight > candidates[j].weight
+	})
+
+	for _, candidate := range candidates {
+		for _, locale := range supported {
+			if candidate.locale == locale && candidate.weight > 0 {
+				return locale
+			}
+		}
+	}
+	return ""
+}
+
+// localizedLabels keeps every non-empty label keyed by normalized locale.
+func localizedLabels(label map[string]string) map[string]string {
+	names := make(map[string]string)
+	for key, value := range label {
+		locale := NormalizeLocale(key)
+		value = strings.TrimSpace(value)
+		if locale == "" || value == "" {
+			continue
+		}
+		if _, exists := names[locale]; exists && key != locale {
+			continue
+		}
+		names[locale] = value
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	return names
+}
+
+// LocalizedName returns the card name in locale, falling back to Name.
+func (c Card) LocalizedName(locale string) string {
+	if name := strings.TrimSpace(c.Names[NormalizeLocale(locale)]); name != "" {
+		return name
+	}
+	return c.Name
+}
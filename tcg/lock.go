@@ -0,0 +1,51 @@
+package tcg
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrDeckLocked  = errors.New("deck is being edited elsewhere")
+	ErrDeckChanged = errors.New("deck file changed since it was loaded")
+)
+
+// deckLockWait is how long LockDeckFile keeps retrying before giving up, so
+// short overlapping requests queue instead of failing.
+const deckLockWait = time.Second
+
+// DeckLock is an advisory lock on a deck file, held in "<file>.lock".
+//
+// On unix the lock is a flock on that file, and the file is never removed,
+// not even after the deck is renamed or deleted: unlinking it would let a
+// second process flock a new inode at the same path while the first still
+// holds the old one. Elsewhere the lock is the exclusively created file
+// itself, so unlocking removes it.
+type DeckLock struct {
+	path   string
+	handle lockHandle
+}
+
+// LockDeckFile takes the advisory lock for the deck file at path. It returns
+// ErrDeckLocked when another process or request keeps holding it.
+func LockDeckFile(path string) (*DeckLock, error) {
+	lockPath := path + ".lock"
+	deadline := time.Now().Add(deckLockWait)
+	for {
+		handle, err := tryLock(lockPath)
+		if err == nil {
+			return &DeckLock{path: lockPath, handle: handle}, nil
+		}
+		if !errors.Is(err, ErrDeckLocked) || time.Now().After(deadline) {
+			return nil, err
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func (l *DeckLock) Unlock() error {
+	if l == nil {
+		return nil
+	}
+	return unlock(l.path, l.handle)
+}
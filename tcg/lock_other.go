@@ -0,0 +1,28 @@
+//go:build !unix
+
+package tcg
+
+import (
+	"errors"
+	"os"
+)
+
+type lockHandle = *os.File
+
+// tryLock falls back to an exclusively created lock file. A crash can leave
+// it behind; delete "<deck>.json.lock" by hand if no tool is running.
+func tryLock(path string) (lockHandle, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o644)
+	if errors.Is(err, os.ErrExist) {
+		return nil, ErrDeckLocked
+	}
+	return file, err
+}
+
+func unlock(path string, file lockHandle) error {
+	file.Close()
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+//go:build unix
+
+package tcg
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+type lockHandle = *os.File
+
+func tryLock(path string) (lockHandle, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		file.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, ErrDeckLocked
+		}
+		return nil, err
+	}
+	return file, nil
+}
+
+func unlock(_ string, file lockHandle) error {
+	return file.Close()
+}
@@ -1,55 +1,310 @@
 package tcg
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
+	"unicode"
 )
 
+var ErrInvalidDeckName = errors.New("invalid deck name")
+
+// maxDeckSlugLength caps the filename derived from a deck name, in runes.
+const maxDeckSlugLength = 64
+
 type DeckManager struct {
-	DecksDir string
+	DecksDir   string
+	Catalog    *Catalog
+	Formats    *FormatRegistry
+	Archetypes *ArchetypeRegistry
 }
 
-func NewDeckManager(decksDir string) (*DeckManager, error) {
+// NewDeckManager also loads the formats from DefaultFormatsDir and the
+// opponent archetype registry kept in decksDir.
+func NewDeckManager(decksDir string, catalog *Catalog) (*DeckManager, error) {
 	if err := os.MkdirAll(decksDir, 0o755); err != nil {
 		return nil, err
 	}
-	return &DeckManager{DecksDir: decksDir}, nil
+	formats, err := LoadFormats(DefaultFormatsDir())
+	if err != nil {
+		return nil, err
+	}
+	archetypes, err := LoadArchetypes(filepath.Join(decksDir, ArchetypesFileName))
+	if err != nil {
+		return nil, err
+	}
+	return &DeckManager{DecksDir: decksDir, Catalog: catalog, Formats: formats, Archetypes: archetypes}, nil
 }
 
+// ListExistingDecks returns the display names of every deck in DecksDir.
 func (m *DeckManager) ListExistingDecks() ([]string, error) {
-	entries, err := os.ReadDir(m.DecksDir)
+	files, err := m.deckFiles()
 	if err != nil {
 		return nil, err
 	}
 
-	var decks []string
-	for _, entry := range entries {
-		if entry.IsDir() {
-			continue
-		}
-		name := entry.Name()
-		if strings.HasSuffix(name, ".json") {
-			decks = append(decks, strings.TrimSuffix(name, ".json"))
-		}
+	decks := make([]string, 0, len(files))
+	for _, file := range files {
+		decks = append(decks, file.name)
 	}
 	sort.Strings(decks)
 	return decks, nil
 }
 
+// CreateDeck and LoadDeck lock the deck file before reading it. The lock is
+// held until the deck is closed; a closed deck can still be saved, see Save.
+// LoadDeck returns an os.ErrNotExist error for a deck that has no file.
 func (m *DeckManager) CreateDeck(name string) (*Deck, error) {
-	deckFile := filepath.Join(m.DecksDir, name+".json")
+	name, err := ValidateDeckName(name)
+	if err != nil {
+		return nil, err
+	}
+	if _, found, err := m.findDeckFile(name); err != nil {
+		return nil, err
+	} else if found {
+		return nil, os.ErrExist
+	}
+
+	deckFile, err := m.newDeckPath(name)
+	if err != nil {
+		return nil, err
+	}
+	lock, err := LockDeckFile(deckFile)
+	if err != nil {
+		return nil, err
+	}
 	if _, err := os.Stat(deckFile); err == nil {
+		lock.Unlock()
 		return nil, os.ErrExist
-	} else if err != nil && !os.IsNotExist(err) {
+	} else if !os.IsNotExist(err) {
+		lock.Unlock()
 		return nil, err
 	}
 
-	return NewDeck(name, deckFile)
+	return m.openLockedDeck(name, deckFile, lock)
 }
 
 func (m *DeckManager) LoadDeck(name string) (*Deck, error) {
-	deckFile := filepath.Join(m.DecksDir, name+".json")
-	return NewDeck(name, deckFile)
+	name, err := ValidateDeckName(name)
+	if err != nil {
+		return nil, err
+	}
+	file, found, err := m.findDeckFile(name)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("deck %q: %w", name, os.ErrNotExist)
+	}
+
+	lock, err := LockDeckFile(file.path)
+	if err != nil {
+		return nil, err
+	}
+	deck, err := m.openLockedDeck(file.name, file.path, lock)
+	if err != nil {
+		return nil, err
+	}
+	if deck.LoadStatus == DeckLoadNew {
+		// The file went away while we waited for the lock.
+		deck.Close()
+		return nil, fmt.Errorf("deck %q: %w", file.name, os.ErrNotExist)
+	}
+	return deck, nil
+}
+
+func (m *DeckManager) openLockedDeck(name, deckFile string, lock *DeckLock) (*Deck, error) {
+	deck, err := newDeck(name, deckFile, m.Catalog, lock)
+	if err != nil {
+		lock.Unlock()
+		return nil, err
+	}
+	deck.Formats = m.Formats
+	deck.Archetypes = m.Archetypes
+	return deck, nil
+}
+
+// ValidateDeckName trims name and rejects names that are empty or could be
+// read as a path.
+func ValidateDeckName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	switch {
+	case name == "", name == ".", name == "..":
+		return "", fmt.Errorf("%w %q", ErrInvalidDeckName, name)
+	case strings.ContainsAny(name, `/\`), strings.ContainsRune(name, 0):
+		return "", fmt.Errorf("%w %q: names cannot contain slashes", ErrInvalidDeckName, name)
+	}
+	return name, nil
+}
+
+// DeckSlug turns a display name into the base of its filename, e.g.
+// "Lightning Rush!" becomes "lightning-rush".
+func DeckSlug(name string) string {
+	var b strings.Builder
+	dash := false
+	length := 0
+	for _, r := range strings.ToLower(name) {
+		if length >= maxDeckSlugLength {
+			break
+		}
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+			dash = false
+			length++
+			continue
+		}
+		if !dash && b.Len() > 0 {
+			b.WriteRune('-')
+			dash = true
+			length++
+		}
+	}
+	slug := strings.TrimRight(b.String(), "-")
+	if slug == "" {
+		return "deck"
+	}
+	return slug
+}
+
+type deckFileInfo struct {
+	name string
+	path string
+}
+
+// deckFiles lists the deck files in DecksDir with their display names. Files
+// written before names were stored use their filename stem.
+func (m *DeckManager) deckFiles() ([]deckFileInfo, error) {
+	entries, err := os.ReadDir(m.DecksDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []deckFileInfo
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		path := filepath.Join(m.DecksDir, entry.Name())
+		name := readDeckName(path)
+		if name == "" {
+			name = strings.TrimSuffix(entry.Name(), ".json")
+		}
+		files = append(files, deckFileInfo{name: name, path: path})
+	}
+	return files, nil
+}
+
+// findDeckFile finds the file holding the deck with the given display name,
+// preferring an exact match over a case-insensitive one.
+func (m *DeckManager) findDeckFile(name string) (deckFileInfo, bool, error) {
+	files, err := m.deckFiles()
+	if err != nil {
+		return deckFileInfo{}, false, err
+	}
+	for _, file := range files {
+		if file.name == name {
+			return file, true, nil
+		}
+	}
+	for _, file := range files {
+		if strings.EqualFold(file.name, name) {
+			return file, true, nil
+		}
+	}
+	return deckFileInfo{}, false, nil
+}
+
+// newDeckPath picks an unused filename for name, adding a numeric suffix when
+// another deck already has the same slug.
+func (m *DeckManager) newDeckPath(name string) (string, error) {
+	slug := DeckSlug(name)
+	for suffix := 1; ; suffix++ {
+		base := slug
+		if suffix > 1 {
+			base = fmt.Sprintf("%s-%d", slug, suffix)
+		}
+		path := filepath.Join(m.DecksDir, base+".json")
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			return path, nil
+		} else if err != nil {
+			return "", err
+		}
+	}
+}
+
+func readDeckName(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	var header struct {
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return ""
+	}
+	return strings.TrimSpace(header.Name)
+}
+
+// MergeArchetypes folds opponent archetype from into into and re-keys the
+// battle history of every deck, archived ones included. It returns how many
+// battles changed.
+func (m *DeckManager) MergeArchetypes(from, into string) (int, error) {
+	if err := m.Archetypes.Merge(from, into); err != nil {
+		return 0, err
+	}
+	if err := m.Archetypes.Save(); err != nil {
+		return 0, err
+	}
+
+	files, err := m.deckFiles()
+	if err != nil {
+		return 0, err
+	}
+	archived, _ := filepath.Glob(filepath.Join(m.DecksDir, ArchiveDirName, "*.json"))
+	for _, path := range archived {
+		files = append(files, deckFileInfo{name: strings.TrimSuffix(filepath.Base(path), ".json"), path: path})
+	}
+
+	changed := 0
+	for _, file := range files {
+		count, err := m.rekeyBattles(file)
+		if err != nil {
+			return changed, fmt.Errorf("deck %q: %w", file.name, err)
+		}
+		changed += count
+	}
+	return changed, nil
+}
+
+func (m *DeckManager) rekeyBattles(file deckFileInfo) (int, error) {
+	lock, err := LockDeckFile(file.path)
+	if err != nil {
+		return 0, err
+	}
+	deck, err := m.openLockedDeck(file.name, file.path, lock)
+	if err != nil {
+		return 0, err
+	}
+	defer deck.Close()
+	if deck.LoadStatus != DeckLoadLoaded {
+		return 0, nil
+	}
+
+	changed := 0
+	for idx := range deck.BattleHistory {
+		battle := &deck.BattleHistory[idx]
+		if name := m.Archetypes.Normalize(battle.Opponent); name != battle.Opponent {
+			battle.Opponent = name
+			changed++
+		}
+	}
+	if changed == 0 {
+		return 0, nil
+	}
+	return changed, deck.Save()
 }
@@ -0,0 +1,138 @@
+package tcg
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Outcome is how a battle ended for the deck's owner. The values match the
+// single letters battle records have always been stored with.
+type Outcome string
+
+const (
+	OutcomeWin  Outcome = "W"
+	OutcomeLoss Outcome = "L"
+	OutcomeTie  Outcome = "T"
+)
+
+// ParseOutcome accepts W/L/T and spelled-out forms like "win", "lost" or
+// "draw".
+func ParseOutcome(value string) (Outcome, error) {
+	switch normalizeKey(value) {
+	case "w", "win", "won":
+		return OutcomeWin, nil
+	case "l", "loss", "lose", "lost":
+		return OutcomeLoss, nil
+	case "t", "tie", "tied", "d", "draw":
+		return OutcomeTie, nil
+	}
+	return "", fmt.Errorf("invalid outcome %q", value)
+}
+
+func (o Outcome) String() string {
+	switch o {
+	case OutcomeWin:
+		return "Win"
+	case OutcomeLoss:
+		return "Loss"
+	case OutcomeTie:
+		return "Tie"
+	}
+	return string(o)
+}
+
+// OutcomeReason says how a battle was decided. Reasons describe the losing
+// side, so ReasonConcede on a win means the opponent conceded.
+type OutcomeReason string
+
+const (
+	ReasonPoints     OutcomeReason = "points"
+	ReasonNoPokemon  OutcomeReason = "no_pokemon"
+	ReasonDeckOut    OutcomeReason = "deck_out"
+	ReasonConcede    OutcomeReason = "concede"
+	ReasonDisconnect OutcomeReason = "disconnect"
+	ReasonTurnLimit  OutcomeReason = "turn_limit"
+)
+
+// OutcomeReasons lists every reason in the order menus show them.
+var OutcomeReasons = []OutcomeReason{ReasonPoints, ReasonNoPokemon, ReasonDeckOut, ReasonConcede, ReasonDisconnect, ReasonTurnLimit}
+
+var outcomeReasonAliases = map[string]OutcomeReason{
+	"ko":           ReasonPoints,
+	"knockouts":    ReasonPoints,
+	"prizes":       ReasonPoints,
+	"no pokemon":   ReasonNoPokemon,
+	"no pokémon":   ReasonNoPokemon,
+	"no bench":     ReasonNoPokemon,
+	"benched out":  ReasonNoPokemon,
+	"deck out":     ReasonDeckOut,
+	"decked":       ReasonDeckOut,
+	"decked out":   ReasonDeckOut,
+	"conceded":     ReasonConcede,
+	"concession":   ReasonConcede,
+	"forfeit":      ReasonConcede,
+	"surrender":    ReasonConcede,
+	"dc":           ReasonDisconnect,
+	"disconnected": ReasonDisconnect,
+	"turn limit":   ReasonTurnLimit,
+	"time":         ReasonTurnLimit,
+	"timeout":      ReasonTurnLimit,
+	"time limit":   ReasonTurnLimit,
+}
+
+// ParseOutcomeReason accepts a reason name with spaces, dashes or
+// underscores, and common alternatives like "dc" or "forfeit". An empty
+// value means the reason was not recorded.
+func ParseOutcomeReason(value string) (OutcomeReason, error) {
+	key := strings.NewReplacer("_", " ", "-", " ").Replace(normalizeKey(value))
+	key = strings.Join(strings.Fields(key), " ")
+	if key == "" {
+		return "", nil
+	}
+	if reason, ok := outcomeReasonAliases[key]; ok {
+		return reason, nil
+	}
+	reason := OutcomeReason(strings.ReplaceAll(key, " ", "_"))
+	for _, known := range OutcomeReasons {
+		if reason == known {
+			return reason, nil
+		}
+	}
+	return "", fmt.Errorf("invalid outcome reason %q", value)
+}
+
+// Describe returns a short phrase for the reason from the owner's point of
+// view, e.g. "opponent conceded" on a win.
+func (r OutcomeReason) Describe(outcome Outcome) string {
+	switch r {
+	case ReasonPoints:
+		return "on points"
+	case ReasonNoPokemon:
+		if outcome == OutcomeTie {
+			return "both sides out of Pokémon"
+		}
+		return "no Pokémon left"
+	case ReasonDeckOut:
+		return "deck out"
+	case ReasonConcede:
+		if outcome == OutcomeWin {
+			return "opponent conceded"
+		}
+		return "conceded"
+	case ReasonDisconnect:
+		if outcome == OutcomeWin {
+			return "opponent disconnected"
+		}
+		return "disconnected"
+	case ReasonTurnLimit:
+		return "turn limit"
+	}
+	return string(r)
+}
+
+// allowsTie reports whether a game ending this way can be a draw. Conceding,
+// disconnecting, decking out and reaching the points target always leave a
+// winner.
+func (r OutcomeReason) allowsTie() bool {
+	return r == "" || r == ReasonNoPokemon || r == ReasonTurnLimit
+}
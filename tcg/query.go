@@ -0,0 +1,142 @@
+package tcg
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StatsQuery narrows the battles Deck.StatsFor aggregates. Zero fields do
+// not filter. Since is inclusive and Until exclusive; Last keeps the most
+// recent N battles left after the other filters.
+type StatsQuery struct {
+	Since     time.Time `json:"since"`
+	Until     time.Time `json:"until"`
+	Last      int       `json:"last,omitempty"`
+	Mode      GameMode  `json:"mode,omitempty"`
+	TurnOrder TurnOrder `json:"turn_order,omitempty"`
+	Opponent  string    `json:"opponent,omitempty"`
+	Tags      []string  `json:"tags,omitempty"`
+}
+
+// IsZero reports whether the query keeps every battle.
+func (q StatsQuery) IsZero() bool {
+	return q.Since.IsZero() && q.Until.IsZero() && q.Last <= 0 && q.Mode == "" && q.TurnOrder == "" && strings.TrimSpace(q.Opponent) == "" && len(q.Tags) == 0
+}
+
+// MarshalJSON leaves out unset date bounds instead of writing zero times.
+func (q StatsQuery) MarshalJSON() ([]byte, error) {
+	type plain StatsQuery
+	out := struct {
+		plain
+		Since string `json:"since,omitempty"`
+		Until string `json:"until,omitempty"`
+	}{plain: plain(q)}
+	if !q.Since.IsZero() {
+		out.Since = q.Since.Format(time.RFC3339)
+	}
+	if !q.Until.IsZero() {
+		out.Until = q.Until.Format(time.RFC3339)
+	}
+	return json.Marshal(out)
+}
+
+// Describe summarises the filters, e.g. "ranked, since 2026-03-01, last 20
+// game(s)". It is empty for a zero query.
+func (q StatsQuery) Describe(location *time.Location) string {
+	var parts []string
+	if q.Mode != "" {
+		parts = append(parts, string(q.Mode))
+	}
+	if q.TurnOrder != "" {
+		parts = append(parts, "going "+string(q.TurnOrder))
+	}
+	if opponent := strings.TrimSpace(q.Opponent); opponent != "" {
+		parts = append(parts, "vs "+opponent)
+	}
+	if len(q.Tags) > 0 {
+		parts = append(parts, "tagged "+strings.Join(q.Tags, ", "))
+	}
+	if !q.Since.IsZero() {
+		parts = append(parts, "since "+q.Since.In(location).Format("2006-01-02"))
+	}
+	if !q.Until.IsZero() {
+		parts = append(parts, "before "+q.Until.In(location).Format("2006-01-02"))
+	}
+	if q.Last > 0 {
+		parts = append(parts, fmt.Sprintf("last %d game(s)", q.Last))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// ParseStatsDate reads a date filter: "2006-01-02" (midnight in location),
+// an RFC 3339 timestamp, or a count of days back from now such as "30d".
+func ParseStatsDate(value string, now time.Time, location *time.Location) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if days, ok := strings.CutSuffix(strings.ToLower(value), "d"); ok {
+		if count, err := strconv.Atoi(days); err == nil && count >= 0 {
+			today := now.In(location)
+			midnight := time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, location)
+			return midnight.AddDate(0, 0, -count), nil
+		}
+	}
+	if date, err := time.ParseInLocation("2006-01-02", value, location); err == nil {
+		return date, nil
+	}
+	if date, err := time.Parse(time.RFC3339, value); err == nil {
+		return date, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q (use YYYY-MM-DD or a number of days like 30d)", value)
+}
+
+// filterBattles returns the battles matching q in history order, or in date
+// order when Last trims them.
+func (d *Deck) filterBattles(q StatsQuery) []BattleRecord {
+	opponent := d.Archetypes.Normalize(q.Opponent)
+	var battles []BattleRecord
+	for _, battle := range d.BattleHistory {
+		switch {
+		case !q.Since.IsZero() && battle.Date.Before(q.Since):
+			continue
+		case !q.Until.IsZero() && !battle.Date.Before(q.Until):
+			continue
+		case q.Mode != "" && battle.Mode != q.Mode:
+			continue
+		case q.TurnOrder != "" && battle.TurnOrder != q.TurnOrder:
+			continue
+		case opponent != "" && !strings.EqualFold(d.Archetypes.Normalize(battle.Opponent), opponent):
+			continue
+		case !hasTags(battle.Tags, q.Tags):
+			continue
+		}
+		battles = append(battles, battle)
+	}
+	if q.Last > 0 && len(battles) > q.Last {
+		sort.SliceStable(battles, func(i, j int) bool { return battles[i].Date.Before(battles[j].Date) })
+		battles = battles[len(battles)-q.Last:]
+	}
+	return battles
+}
+
+// hasTags reports whether tags contains every wanted tag, ignoring case.
+func hasTags(tags, wanted []string) bool {
+	for _, want := range wanted {
+		found := false
+		for _, tag := range tags {
+			if strings.EqualFold(tag, strings.TrimSpace(want)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,144 @@
+package tcg
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var ErrUnconfirmedOverwrite = errors.New("deck file could not be read; confirm before overwriting it")
+
+// recoverCorruptDeck keeps a quarantine copy of a deck file that failed to
+// decode and loads whatever cards and battles can still be parsed from it.
+func (d *Deck) recoverCorruptDeck(original []byte, decodeErr error) error {
+	quarantine, err := quarantineDeckFile(d.FilePath, original)
+	if err != nil {
+		return fmt.Errorf("quarantine %s: %w", d.FilePath, err)
+	}
+
+	d.Cards, d.BattleHistory = salvageDeckFile(original)
+	d.ensureBattleIDs()
+	d.LoadError = fmt.Errorf("decode %s: %w", d.FilePath, decodeErr)
+	d.QuarantinePath = quarantine
+	return nil
+}
+
+// ConfirmOverwrite allows Save to replace a deck file that failed to load or
+// that was changed elsewhere since it was loaded.
+func (d *Deck) ConfirmOverwrite() {
+	d.overwriteConfirmed = true
+}
+
+// quarantineDeckFile copies a damaged deck file to "<file>.<timestamp>.corrupt".
+// The original stays in place until the user agrees to overwrite it, and an
+// existing quarantine copy with the same contents is reused.
+func quarantineDeckFile(path string, original []byte) (string, error) {
+	existing, _ := filepath.Glob(path + ".*.corrupt")
+	for _, candidate := range existing {
+		data, err := os.ReadFile(candidate)
+		if err == nil && bytes.Equal(data, original) {
+			return candidate, nil
+		}
+	}
+
+	quarantine := fmt.Sprintf("%s.%s.corrupt", path, time.Now().Format("20060102T150405"))
+	if err := os.WriteFile(quarantine, original, 0o644); err != nil {
+		return "", err
+	}
+	return quarantine, nil
+}
+
+// salvageDeckFile walks the top-level object token by token and keeps every
+// card entry and battle record that decodes, stopping at the first syntax
+// error.
+func salvageDeckFile(data []byte) ([]CardEntry, []BattleRecord) {
+	cards := []CardEntry{}
+	var battles []map[string]json.RawMessage
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return cards, []BattleRecord{}
+	}
+walk:
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			break
+		}
+		key, _ := token.(string)
+		switch key {
+		case "cards":
+			var ok bool
+			if cards, ok = salvageArray(decoder, cards); !ok {
+				break walk
+			}
+		case "battle_history":
+			var ok bool
+			if battles, ok = salvageArray(decoder, battles); !ok {
+				break walk
+			}
+		default:
+			var skip json.RawMessage
+			if err := decoder.Decode(&skip); err != nil {
+				break walk
+			}
+		}
+	}
+	return cards, salvageBattles(battles)
+}
+
+// salvageBattles decodes recovered battles, converting dates from any schema
+// version on the way.
+func salvageBattles(raw []map[string]json.RawMessage) []BattleRecord {
+	location, err := LegacyTimeZone()
+	if err != nil {
+		location = time.Local
+	}
+	battles := []BattleRecord{}
+	for _, battle := range raw {
+		migrateBattleDate(battle, location)
+		encoded, err := json.Marshal(battle)
+		if err != nil {
+			continue
+		}
+		var record BattleRecord
+		if err := json.Unmarshal(encoded, &record); err != nil {
+			continue
+		}
+		battles = append(battles, record)
+	}
+	return battles
+}
+
+// salvageArray decodes array elements into out, skipping elements with the
+// wrong shape. It reports false once the input can no longer be read.
+func salvageArray[T any](decoder *json.Decoder, out []T) ([]T, bool) {
+	token, err := decoder.Token()
+	if err != nil {
+		return out, false
+	}
+	if token != json.Delim('[') {
+		// A scalar has been consumed whole; an object has not.
+		_, isDelim := token.(json.Delim)
+		return out, !isDelim
+	}
+	for decoder.More() {
+		var value T
+		if err := decoder.Decode(&value); err != nil {
+			var typeErr *json.UnmarshalTypeError
+			if errors.As(err, &typeErr) {
+				continue
+			}
+			return out, false
+		}
+		out = append(out, value)
+	}
+	if _, err := decoder.Token(); err != nil {
+		return out, false
+	}
+	return out, true
+}
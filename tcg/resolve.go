@@ -0,0 +1,231 @@
+package tcg
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type CardResolutionStatus string
+
+const (
+	CardResolutionAmbiguous  CardResolutionStatus = "ambiguous"
+	CardResolutionUnresolved CardResolutionStatus = "unresolved"
+)
+
+// CardResolutionIssue describes a deck entry that could not be tied to a
+// single catalog card. Index refers to the entry's position in Deck.Cards.
+type CardResolutionIssue struct {
+	Index      int                  `json:"index"`
+	Entry      CardEntry            `json:"entry"`
+	Status     CardResolutionStatus `json:"status"`
+	Candidates []Card               `json:"candidates,omitempty"`
+}
+
+// CardMigration reports what resolveCardIDs did when the deck was loaded.
+type CardMigration struct {
+	Resolved int                   `json:"resolved"`
+	Merged   int                   `json:"merged"`
+	Issues   []CardResolutionIssue `json:"issues,omitempty"`
+}
+
+// resolveCardIDs fills in card IDs for legacy name/set entries, refreshes the
+// name and set of entries whose ID is known, and merges entries that turn out
+// to be the same card.
+func (d *Deck) resolveCardIDs() CardMigration {
+	var migration CardMigration
+	if d.Catalog.Len() == 0 {
+		return migration
+	}
+
+	for idx := range d.Cards {
+		entry := &d.Cards[idx]
+		if entry.ID != "" {
+			if card, ok := d.Catalog.lookupID(entry.ID); ok {
+				entry.ID, entry.Name, entry.Set = card.ID, card.Name, card.Set
+			}
+			continue
+		}
+		if candidates := d.Catalog.matchEntry(entry.Name, entry.Set); len(candidates) == 1 {
+			entry.ID, entry.Name, entry.Set = candidates[0].ID, candidates[0].Name, candidates[0].Set
+			migration.Resolved++
+		}
+	}
+
+	merged := make([]CardEntry, 0, len(d.Cards))
+	positions := make(map[string]int)
+	for _, entry := range d.Cards {
+		key := normalizeKey(entry.ID)
+		if pos, ok := positions[key]; ok && key != "" {
+			merged[pos].Count += entry.Count
+			migration.Merged++
+			continue
+		}
+		positions[key] = len(merged)
+		merged = append(merged, entry)
+	}
+	d.Cards = merged
+
+	for idx, entry := range d.Cards {
+		if entry.ID != "" {
+			if _, ok := d.Catalog.lookupID(entry.ID); !ok {
+				migration.Issues = append(migration.Issues, CardResolutionIssue{Index: idx, Entry: entry, Status: CardResolutionUnresolved})
+			}
+			continue
+		}
+		candidates := d.Catalog.matchEntry(entry.Name, entry.Set)
+		issue := CardResolutionIssue{Index: idx, Entry: entry, Status: CardResolutionUnresolved}
+		if len(candidates) > 1 {
+			issue.Status = CardResolutionAmbiguous
+			for _, candidate := range candidates {
+				issue.Candidates = append(issue.Candidates, d.Catalog.localize(candidate))
+			}
+		}
+		migration.Issues = append(migration.Issues, issue)
+	}
+	return migration
+}
+
+// ResolveEntry ties the entry at index to cardID, typically after the user
+// picked one of the candidates of an ambiguous entry.
+func (d *Deck) ResolveEntry(index int, cardID string) (CardEntry, error) {
+	if index < 0 || index >= len(d.Cards) {
+		return CardEntry{}, fmt.Errorf("index %d out of range", index)
+	}
+	card, ok := d.Catalog.lookupID(cardID)
+	if !ok {
+		return CardEntry{}, fmt.Errorf("card ID %q not found", cardID)
+	}
+
+	entry := &d.Cards[index]
+	entry.ID, entry.Name, entry.Set = card.ID, card.Name, card.Set
+	d.CardMigration.Resolved++
+
+	issues := d.CardMigration.Issues[:0]
+	for _, issue := range d.CardMigration.Issues {
+		if issue.Index != index {
+			issues = append(issues, issue)
+		}
+	}
+	d.CardMigration.Issues = issues
+	return *entry, nil
+}
+
+// DisplayCards returns the deck entries with names and sets in the catalog's
+// locale. The stored entries keep their canonical names.
+func (d *Deck) DisplayCards() []CardEntry {
+	entries := make([]CardEntry, len(d.Cards))
+	for idx, entry := range d.Cards {
+		if card, ok := d.Catalog.FindByID(entry.ID); ok {
+			entry.Name, entry.Set = card.Name, card.Set
+		}
+		entries[idx] = entry
+	}
+	return entries
+}
+
+// matchEntry finds catalog cards for a legacy entry. Names match exactly when
+// possible and otherwise by the closest spelling; the set narrows the result
+// when it matches any of the card's set code, name or display string.
+func (c *Catalog) matchEntry(name, set string) []Card {
+	indexes := c.byName[normalizeKey(name)]
+	if len(indexes) == 0 {
+		indexes = c.closestNames(name)
+	}
+	if len(indexes) == 0 {
+		return nil
+	}
+
+	var inSet []int
+	if folded := foldText(set); folded != "" {
+		for _, idx := range indexes {
+			if c.cardInSet(c.cards[idx], folded) {
+				inSet = append(inSet, idx)
+			}
+		}
+	}
+	if len(inSet) > 0 {
+		indexes = inSet
+	}
+
+	var cards []Card
+	for _, idx := range indexes {
+		cards = append(cards, c.cards[idx])
+	}
+	return cards
+}
+
+func (c *Catalog) closestNames(name string) []int {
+	target := foldText(name)
+	if target == "" {
+		return nil
+	}
+	tolerance := len([]rune(target)) / 6
+	if tolerance < 1 {
+		tolerance = 1
+	}
+
+	best := tolerance + 1
+	var matches []int
+	for key, indexes := range c.byName {
+		distance := levenshtein(foldText(key), target)
+		if distance > tolerance || distance > best {
+			continue
+		}
+		if distance < best {
+			best = distance
+			matches = nil
+		}
+		matches = append(matches, indexes...)
+	}
+	return matches
+}
+
+func (c *Catalog) cardInSet(card Card, foldedSet string) bool {
+	labels := []string{card.SetCode, card.Set, setNameFromDisplay(card.Set)}
+	if idx, ok := c.setIdx[normalizeKey(card.SetCode)]; ok {
+		labels = append(labels, c.sets[idx].Name)
+		for _, name := range c.sets[idx].Names {
+			labels = append(labels, name)
+		}
+	}
+	for _, label := range labels {
+		if foldText(label) == foldedSet {
+			return true
+		}
+	}
+	return false
+}
+
+// foldText lowercases and drops everything but letters and digits, so
+// "Pikachu-EX" and "pikachu ex" compare equal.
+func foldText(value string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(value) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func levenshtein(a, b string) int {
+	left, right := []rune(a), []rune(b)
+	previous := make([]int, len(right)+1)
+	current := make([]int, len(right)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(left); i++ {
+		current[0] = i
+		for j := 1; j <= len(right); j++ {
+			cost := 1
+			if left[i-1] == right[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(right)]
+}
@@ -0,0 +1,211 @@
+package tcg
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// CurrentDeckSchemaVersion is the deck file format written by Save. Files
+// without a schema_version field are version 0.
+const CurrentDeckSchemaVersion = 3
+
+var ErrUnsupportedDeckSchema = errors.New("unsupported deck file schema version")
+
+// errMalformedDeck marks a deck file whose structure a migration cannot work
+// with; the loader sends it through the corrupt-file recovery instead.
+var errMalformedDeck = errors.New("malformed deck file")
+
+// deckDocument is a deck file decoded just far enough to migrate it.
+type deckDocument map[string]json.RawMessage
+
+// deckMigrations upgrades a document from version From to From+1. Entries
+// must stay in order and cover every version below CurrentDeckSchemaVersion.
+var deckMigrations = []struct {
+	From    int
+	Migrate func(doc deckDocument) error
+}{
+	{From: 0, Migrate: migrateDeckV0},
+	{From: 1, Migrate: migrateDeckV1},
+	{From: 2, Migrate: migrateDeckV2},
+}
+
+// SchemaMigration records that a deck file was upgraded on load.
+type SchemaMigration struct {
+	From       int    `json:"from"`
+	To         int    `json:"to"`
+	BackupPath string `json:"backup_path"`
+}
+
+// migrateDeckV0 makes the card and battle lists explicit arrays; version 0
+// files could contain null for either.
+func migrateDeckV0(doc deckDocument) error {
+	for _, key := range []string{"cards", "battle_history"} {
+		if raw, ok := doc[key]; !ok || bytes.Equal(bytes.TrimSpace(raw), []byte("null")) {
+			doc[key] = json.RawMessage("[]")
+		}
+	}
+	return nil
+}
+
+// migrateDeckV1 splits the free-text opponent of each battle into the
+// opponent archetype and notes, using the separators people typed by hand.
+func migrateDeckV1(doc deckDocument) error {
+	battles, err := doc.battles()
+	if err != nil {
+		return err
+	}
+	for _, battle := range battles {
+		name, details := splitLegacyOpponent(legacyString(battle["opponent"]))
+		battle["opponent"], _ = json.Marshal(name)
+		if details != "" {
+			battle["notes"], _ = json.Marshal(details)
+		}
+	}
+	return doc.setBattles(battles)
+}
+
+// migrateDeckV2 rewrites battle dates from local "2006-01-02 15:04:05"
+// strings to RFC 3339, assuming LegacyTimeZone for the missing zone.
+func migrateDeckV2(doc deckDocument) error {
+	location, err := LegacyTimeZone()
+	if err != nil {
+		return err
+	}
+	battles, err := doc.battles()
+	if err != nil {
+		return err
+	}
+	for _, battle := range battles {
+		migrateBattleDate(battle, location)
+	}
+	return doc.setBattles(battles)
+}
+
+// battles decodes the battle history for a migration. Entries that are not
+// objects cannot be migrated and are dropped; the pre-migration backup still
+// has them.
+func (doc deckDocument) battles() ([]map[string]json.RawMessage, error) {
+	var entries []json.RawMessage
+	if err := json.Unmarshal(doc["battle_history"], &entries); err != nil {
+		return nil, fmt.Errorf("%w: battle_history is not an array", errMalformedDeck)
+	}
+	battles := []map[string]json.RawMessage{}
+	for _, entry := range entries {
+		var battle map[string]json.RawMessage
+		if err := json.Unmarshal(entry, &battle); err != nil || battle == nil {
+			continue
+		}
+		battles = append(battles, battle)
+	}
+	return battles, nil
+}
+
+func (doc deckDocument) setBattles(battles []map[string]json.RawMessage) error {
+	encoded, err := json.Marshal(battles)
+	if err != nil {
+		return err
+	}
+	doc["battle_history"] = encoded
+	return nil
+}
+
+// legacyString reads a hand-edited text field. Numbers and booleans keep
+// their JSON text, so an opponent typed as 42 becomes "42"; null, objects and
+// arrays read as empty.
+func legacyString(raw json.RawMessage) string {
+	var value string
+	if err := json.Unmarshal(raw, &value); err == nil {
+		return value
+	}
+	var scalar any
+	if err := json.Unmarshal(raw, &scalar); err != nil {
+		return ""
+	}
+	switch scalar.(type) {
+	case float64, bool:
+		return string(bytes.TrimSpace(raw))
+	}
+	return ""
+}
+
+// migrateBattleDate converts one battle's date in place. A date that cannot
+// be read is dropped and kept in the notes so nothing is lost.
+func migrateBattleDate(battle map[string]json.RawMessage, location *time.Location) {
+	raw, ok := battle["date"]
+	if !ok {
+		return
+	}
+	value := strings.TrimSpace(legacyString(raw))
+	delete(battle, "date")
+	if value == "" {
+		return
+	}
+	date, err := parseBattleDate(value, location)
+	if err != nil {
+		notes := strings.TrimSpace(legacyString(battle["notes"]) + " (recorded " + value + ")")
+		battle["notes"], _ = json.Marshal(notes)
+		return
+	}
+	battle["date"], _ = json.Marshal(date.Format(time.RFC3339))
+}
+
+func (doc deckDocument) schemaVersion() (int, error) {
+	raw, ok := doc["schema_version"]
+	if !ok {
+		return 0, nil
+	}
+	var version int
+	if err := json.Unmarshal(raw, &version); err != nil {
+		return 0, fmt.Errorf("invalid schema_version: %w", err)
+	}
+	return version, nil
+}
+
+// upgradeDeckDocument applies migrations until doc is at the current version.
+// It returns the version the document started at.
+func upgradeDeckDocument(doc deckDocument) (int, error) {
+	from, err := doc.schemaVersion()
+	if err != nil {
+		return 0, err
+	}
+	if from > CurrentDeckSchemaVersion {
+		return from, fmt.Errorf("%w %d (this build supports up to %d)", ErrUnsupportedDeckSchema, from, CurrentDeckSchemaVersion)
+	}
+	if from < 0 {
+		return from, fmt.Errorf("%w %d", ErrUnsupportedDeckSchema, from)
+	}
+
+	version := from
+	for _, migration := range deckMigrations {
+		if migration.From != version {
+			continue
+		}
+		if err := migration.Migrate(doc); err != nil {
+			return from, fmt.Errorf("migrate deck schema %d to %d: %w", version, version+1, err)
+		}
+		version++
+		doc["schema_version"] = json.RawMessage(fmt.Sprint(version))
+	}
+	if version != CurrentDeckSchemaVersion {
+		return from, fmt.Errorf("no migration from deck schema version %d", version)
+	}
+	return from, nil
+}
+
+// backupDeckFile writes the pre-migration contents next to the deck file,
+// e.g. "Deck.json.v0.bak".
+func backupDeckFile(path string, version int, original []byte) (string, error) {
+	backup := fmt.Sprintf("%s.v%d.bak", path, version)
+	if _, err := os.Stat(backup); err == nil {
+		backup = fmt.Sprintf("%s.v%d.%s.bak", path, version, time.Now().Format("20060102T150405"))
+	}
+	if err := os.WriteFile(backup, original, 0o644); err != nil {
+		return "", err
+	}
+	return backup, nil
+}
@@ -0,0 +1,82 @@
+package tcg
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func loadTestDeck(t *testing.T, body string) *Deck {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "deck.json")
+	if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	deck, err := NewDeck("deck", path, NewCatalog(nil, nil))
+	if err != nil {
+		t.Fatalf("load %s: %v", body, err)
+	}
+	return deck
+}
+
+func TestLoadDeckNonObjectBody(t *testing.T) {
+	for _, body := range []string{"null", "[]", `"str"`} {
+		deck := loadTestDeck(t, body)
+		if deck.LoadStatus != DeckLoadReset {
+			t.Errorf("%s: status %q, want %q", body, deck.LoadStatus, DeckLoadReset)
+		}
+		if deck.QuarantinePath == "" {
+			t.Errorf("%s: not quarantined", body)
+		}
+		if len(deck.Cards) != 0 || len(deck.BattleHistory) != 0 {
+			t.Errorf("%s: salvaged %d cards and %d battles", body, len(deck.Cards), len(deck.BattleHistory))
+		}
+	}
+}
+
+func TestMigrateWrongTypedOpponent(t *testing.T) {
+	deck := loadTestDeck(t, `{
+		"cards": [],
+		"battle_history": [
+			{"date": "2024-01-02 10:00:00", "result": "W", "opponent": 42},
+			{"date": "2024-01-03 10:00:00", "result": "L", "opponent": "Mewtwo ex - lost on time"},
+			"not a battle"
+		]
+	}`)
+	if deck.LoadStatus != DeckLoadLoaded {
+		t.Fatalf("status %q (%v), want %q", deck.LoadStatus, deck.LoadError, DeckLoadLoaded)
+	}
+	if len(deck.BattleHistory) != 2 {
+		t.Fatalf("got %d battles, want 2", len(deck.BattleHistory))
+	}
+	if got := deck.BattleHistory[0].Opponent; got != "42" {
+		t.Errorf("opponent %q, want %q", got, "42")
+	}
+	if got := deck.BattleHistory[1]; got.Opponent != "Mewtwo ex" || got.Notes != "lost on time" {
+		t.Errorf("opponent %q, notes %q; want the legacy text split", got.Opponent, got.Notes)
+	}
+}
+
+func TestMigrateWrongTypedDate(t *testing.T) {
+	deck := loadTestDeck(t, `{
+		"schema_version": 2,
+		"cards": [],
+		"battle_history": [
+			{"date": 20240103, "result": "L", "opponent": "Mewtwo ex"},
+			{"date": "2024-01-04 10:00:00", "result": "W", "opponent": "Pikachu ex"}
+		]
+	}`)
+	if deck.LoadStatus != DeckLoadLoaded {
+		t.Fatalf("status %q (%v), want %q", deck.LoadStatus, deck.LoadError, DeckLoadLoaded)
+	}
+	if len(deck.BattleHistory) != 2 {
+		t.Fatalf("got %d battles, want 2", len(deck.BattleHistory))
+	}
+	first := deck.BattleHistory[0]
+	if !first.Date.IsZero() || first.Notes != "(recorded 20240103)" {
+		t.Errorf("date %v, notes %q; want no date and the value kept in notes", first.Date, first.Notes)
+	}
+	if deck.BattleHistory[1].Date.IsZero() {
+		t.Error("readable date was dropped")
+	}
+}
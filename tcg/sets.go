@@ -0,0 +1,108 @@
+package tcg
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// Set describes an expansion. ReleaseDate uses the YYYY-MM-DD form.
+type Set struct {
+	Code        string            `json:"code"`
+	Name        string            `json:"name"`
+	Names       map[string]string `json:"names,omitempty"`
+	ReleaseDate string            `json:"release_date,omitempty"`
+	Packs       []string          `json:"packs,omitempty"`
+	CardCount   int               `json:"card_count"`
+}
+
+// Released parses ReleaseDate. It reports false when the date is unknown.
+func (s Set) Released() (time.Time, bool) {
+	released, err := time.Parse("2006-01-02", strings.TrimSpace(s.ReleaseDate))
+	if err != nil {
+		return time.Time{}, false
+	}
+	return released, true
+}
+
+func (s Set) LocalizedName(locale string) string {
+	if name := strings.TrimSpace(s.Names[NormalizeLocale(locale)]); name != "" {
+		return name
+	}
+	return s.Name
+}
+
+// setCodeFromDisplay extracts "A1" from display strings like
+// "Genetic Apex (A1)". Strings without a code are used as-is.
+func setCodeFromDisplay(display string) string {
+	display = strings.TrimSpace(display)
+	open := strings.LastIndex(display, "(")
+	if open >= 0 && strings.HasSuffix(display, ")") {
+		if code := strings.TrimSpace(display[open+1 : len(display)-1]); code != "" {
+			return code
+		}
+	}
+	return display
+}
+
+func setNameFromDisplay(display string) string {
+	display = strings.TrimSpace(display)
+	if open := strings.LastIndex(display, "("); open > 0 && strings.HasSuffix(display, ")") {
+		return strings.TrimSpace(display[:open])
+	}
+	return display
+}
+
+// buildSets merges the declared sets with the sets referenced by cards, so
+// catalogs loaded from plain card lists still have a registry.
+func buildSets(cards []Card, declared []Set) []Set {
+	counts := make(map[string]int)
+	for _, card := range cards {
+		counts[normalizeKey(card.SetCode)]++
+	}
+
+	byCode := make(map[string]int)
+	var sets []Set
+	for _, set := range declared {
+		key := normalizeKey(set.Code)
+		if key == "" {
+			continue
+		}
+		if _, exists := byCode[key]; exists {
+			continue
+		}
+		if set.CardCount == 0 {
+			set.CardCount = counts[key]
+		}
+		byCode[key] = len(sets)
+		sets = append(sets, set)
+	}
+	for _, card := range cards {
+		key := normalizeKey(card.SetCode)
+		if key == "" {
+			continue
+		}
+		if _, exists := byCode[key]; exists {
+			continue
+		}
+		byCode[key] = len(sets)
+		sets = append(sets, Set{
+			Code:      card.SetCode,
+			Name:      setNameFromDisplay(card.Set),
+			CardCount: counts[key],
+		})
+	}
+
+	sort.SliceStable(sets, func(i, j int) bool {
+		left, leftOK := sets[i].Released()
+		right, rightOK := sets[j].Released()
+		if leftOK && rightOK && !left.Equal(right) {
+			return left.Before(right)
+		}
+		if leftOK != rightOK {
+			return leftOK
+		}
+		return sets[i].Code < sets[j].Code
+	})
+	return sets
+}
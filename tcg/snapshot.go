@@ -0,0 +1,94 @@
+package tcg
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+)
+
+// SnapshotStaleAfter is how old the embedded snapshot may get before the UIs
+// warn that card data may be missing recent sets.
+const SnapshotStaleAfter = 60 * 24 * time.Hour
+
+//go:embed catalog_snapshot.json
+var embeddedSnapshot []byte
+
+type catalogSnapshot struct {
+	Generated time.Time `json:"generated"`
+	Sets      []Set     `json:"sets,omitempty"`
+	Cards     []Card    `json:"cards"`
+}
+
+// SnapshotSource serves the catalog snapshot compiled into the binary. It is
+// the last link of DefaultCardSource so decks always have card data.
+func SnapshotSource() CardSource {
+	return &EmbeddedSource{Name: "catalog_snapshot.json", Data: embeddedSnapshot}
+}
+
+// SnapshotGenerated reports when the embedded snapshot was produced.
+func SnapshotGenerated() time.Time {
+	snapshot, err := decodeSnapshot(bytes.NewReader(embeddedSnapshot))
+	if err != nil {
+		return time.Time{}
+	}
+	return snapshot.Generated
+}
+
+func SnapshotIsStale(now time.Time) bool {
+	generated := SnapshotGenerated()
+	return generated.IsZero() || now.Sub(generated) > SnapshotStaleAfter
+}
+
+// WriteSnapshot encodes sets and cards in the embedded snapshot format. It
+// refuses a catalog without sets or card metadata, such as a bare list like
+// valid_cards.json, since offline validation depends on both.
+func WriteSnapshot(w io.Writer, cards []Card, sets []Set, generated time.Time) error {
+	if err := checkSnapshot(cards, sets); err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	return encoder.Encode(catalogSnapshot{Generated: generated.UTC(), Sets: sets, Cards: cards})
+}
+
+func checkSnapshot(cards []Card, sets []Set) error {
+	if len(cards) == 0 {
+		return errors.New("snapshot has no cards")
+	}
+	if len(sets) == 0 {
+		return errors.New("snapshot has no sets")
+	}
+	for _, card := range cards {
+		if card.Stage != "" {
+			return nil
+		}
+	}
+	return errors.New("snapshot cards have no stage data")
+}
+
+// decodeSnapshot accepts both the snapshot object and a bare card array like
+// valid_cards.json.
+func decodeSnapshot(r io.Reader) (catalogSnapshot, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return catalogSnapshot{}, err
+	}
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		cards, err := decodeLocalCards(bytes.NewReader(trimmed))
+		return catalogSnapshot{Cards: cards}, err
+	}
+
+	var snapshot catalogSnapshot
+	if err := json.Unmarshal(trimmed, &snapshot); err != nil {
+		return catalogSnapshot{}, err
+	}
+	for idx := range snapshot.Cards {
+		normalizeCard(&snapshot.Cards[idx])
+	}
+	return snapshot, nil
+}
@@ -0,0 +1,46 @@
+package tcg
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestWriteSnapshotRequiresMetadata(t *testing.T) {
+	bare := []Card{{Name: "Bulbasaur", Set: "Genetic Apex (A1)", ID: "a1-001"}}
+	if err := WriteSnapshot(&bytes.Buffer{}, bare, nil, time.Now()); err == nil {
+		t.Fatal("wrote a snapshot without sets")
+	}
+	sets := []Set{{Code: "A1", Name: "Genetic Apex"}}
+	if err := WriteSnapshot(&bytes.Buffer{}, bare, sets, time.Now()); err == nil {
+		t.Fatal("wrote a snapshot without stage data")
+	}
+
+	cards := []Card{{Name: "Bulbasaur", Set: "Genetic Apex (A1)", ID: "a1-001", Type: CardTypePokemon, Stage: StageBasic}}
+	var buf bytes.Buffer
+	if err := WriteSnapshot(&buf, cards, sets, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	snapshot, err := decodeSnapshot(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshot.Sets) == 0 || snapshot.Cards[0].Stage != StageBasic {
+		t.Errorf("round trip lost sets or stage: %+v", snapshot)
+	}
+}
+
+// The embedded snapshot is what offline validation runs on, so it must be
+// real tcgsnapshot output rather than a bare card list.
+func TestEmbeddedSnapshotIsComplete(t *testing.T) {
+	snapshot, err := decodeSnapshot(bytes.NewReader(embeddedSnapshot))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkSnapshot(snapshot.Cards, snapshot.Sets); err != nil {
+		t.Fatalf("catalog_snapshot.json: %v; regenerate it with go run ./cmd/tcgsnapshot -o tcg/catalog_snapshot.json", err)
+	}
+	if len(snapshot.Sets) == 0 {
+		t.Fatal("catalog_snapshot.json has no sets")
+	}
+}
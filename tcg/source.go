@@ -0,0 +1,197 @@
+package tcg
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	defaultLocalCardsPath = "valid_cards.json"
+	defaultFetchTimeout   = 15 * time.Second
+
+	// revalidateTimeout bounds the conditional refresh when a cached catalog
+	// is already on disk, so offline starts fall back to the cache quickly.
+	revalidateTimeout = 3 * time.Second
+)
+
+// CardSource produces the list of valid cards. Implementations can be chained
+// with ChainSource so the first one that succeeds serves the catalog.
+type CardSource interface {
+	Load() (CardLoad, error)
+}
+
+// CardLoad is the result of a successful CardSource load. Origin names the URL
+// or path that served the cards; Warning carries a non-fatal problem such as a
+// failed refresh that was answered from the cache.
+type CardLoad struct {
+	Cards   []Card
+	Sets    []Set
+	Source  CardsSource
+	Origin  string
+	Warning error
+}
+
+type HTTPSource struct {
+	CardsURL string
+	SetsURL  string
+	Client   *http.Client
+	Cache    *CatalogCache
+}
+
+type FileSource struct {
+	Path string
+}
+
+// EmbeddedSource serves cards compiled into the binary, either as a snapshot
+// object or as a bare card array.
+type EmbeddedSource struct {
+	Name string
+	Data []byte
+}
+
+type ChainSource []CardSource
+
+// DefaultCardSource builds the standard chain: the configured catalog URLs,
+// any mirrors, the local valid_cards.json and finally the embedded snapshot.
+//
+// TCG_CARDS_URL and TCG_SETS_URL override the primary catalog URLs.
+// TCG_CATALOG_MIRRORS is a comma-separated list of base URLs that serve
+// cards.json and sets.json. TCG_LOCAL_CARDS overrides the local file path.
+func DefaultCardSource() CardSource {
+	cache := DefaultCatalogCache()
+	chain := ChainSource{&HTTPSource{
+		CardsURL: envOr("TCG_CARDS_URL", DefaultCardsURL),
+		SetsURL:  envOr("TCG_SETS_URL", DefaultSetsURL),
+		Cache:    cache,
+	}}
+	for _, mirror := range strings.Split(os.Getenv("TCG_CATALOG_MIRRORS"), ",") {
+		mirror = strings.TrimRight(strings.TrimSpace(mirror), "/")
+		if mirror == "" {
+			continue
+		}
+		chain = append(chain, NewMirrorSource(mirror, cache))
+	}
+	chain = append(chain, &FileSource{Path: envOr("TCG_LOCAL_CARDS", defaultLocalCardsPath)}, SnapshotSource())
+	return chain
+}
+
+// NewMirrorSource returns an HTTPSource for a mirror that serves cards.json
+// and sets.json under baseURL.
+func NewMirrorSource(baseURL string, cache *CatalogCache) *HTTPSource {
+	baseURL = strings.TrimRight(baseURL, "/")
+	return &HTTPSource{
+		CardsURL: baseURL + "/cards.json",
+		SetsURL:  baseURL + "/sets.json",
+		Cache:    cache,
+	}
+}
+
+// Load fetches both documents, answering from the cache while it is fresh and
+// revalidating it otherwise. A cached copy is served with a warning when the
+// network is unreachable.
+func (s *HTTPSource) Load() (CardLoad, error) {
+	var rawCards []remoteCard
+	var rawSets []remoteSet
+
+	client := s.Client
+	if client == nil {
+		timeout := defaultFetchTimeout
+		if s.Cache.cached(s.CardsURL, &rawCards) && s.Cache.cached(s.SetsURL, &rawSets) {
+			timeout = revalidateTimeout
+		}
+		client = &http.Client{Timeout: timeout}
+	}
+
+	cardsResult, err := s.Cache.fetch(client, s.CardsURL, &rawCards)
+	if cardsResult == cacheMiss {
+		return CardLoad{}, err
+	}
+
+	var setsResult cacheResult
+	if cardsResult == cacheStale && s.Cache.cached(s.SetsURL, &rawSets) {
+		// The network just failed; don't wait on it a second time.
+		setsResult = cacheStale
+	} else {
+		var setsErr error
+		setsResult, setsErr = s.Cache.fetch(client, s.SetsURL, &rawSets)
+		if setsResult == cacheMiss {
+			return CardLoad{}, setsErr
+		}
+		if err == nil {
+			err = setsErr
+		}
+	}
+
+	load := CardLoad{
+		Cards:   buildRemoteCards(rawCards, rawSets),
+		Sets:    buildRemoteSets(rawSets),
+		Source:  CardsSourceRemote,
+		Origin:  s.CardsURL,
+		Warning: err,
+	}
+	if cardsResult == cacheStale || setsResult == cacheStale || (cardsResult == cacheFresh && setsResult == cacheFresh) {
+		load.Source = CardsSourceCache
+	}
+	if len(load.Cards) == 0 {
+		return CardLoad{}, fmt.Errorf("no cards found at %s", s.CardsURL)
+	}
+	return load, nil
+}
+
+func (s *FileSource) Load() (CardLoad, error) {
+	file, err := os.Open(s.Path)
+	if err != nil {
+		return CardLoad{}, err
+	}
+	defer file.Close()
+
+	cards, err := decodeLocalCards(file)
+	if err != nil {
+		return CardLoad{}, fmt.Errorf("%s: %w", s.Path, err)
+	}
+	return CardLoad{Cards: cards, Source: CardsSourceLocal, Origin: s.Path}, nil
+}
+
+func (s *EmbeddedSource) Load() (CardLoad, error) {
+	snapshot, err := decodeSnapshot(bytes.NewReader(s.Data))
+	if err != nil {
+		return CardLoad{}, fmt.Errorf("embedded %s: %w", s.Name, err)
+	}
+	if len(snapshot.Cards) == 0 {
+		return CardLoad{}, fmt.Errorf("embedded %s: no cards", s.Name)
+	}
+	return CardLoad{Cards: snapshot.Cards, Sets: snapshot.Sets, Source: CardsSourceEmbedded, Origin: "embedded:" + s.Name}, nil
+}
+
+// Load tries each source in order. Failures of earlier sources are reported
+// as the warning of the load that eventually succeeds.
+func (c ChainSource) Load() (CardLoad, error) {
+	var failures []error
+	for _, source := range c {
+		load, err := source.Load()
+		if err != nil {
+			failures = append(failures, err)
+			continue
+		}
+		if len(failures) > 0 {
+			load.Warning = errors.Join(append(failures, load.Warning)...)
+		}
+		return load, nil
+	}
+	if len(failures) == 0 {
+		return CardLoad{}, errors.New("no card sources configured")
+	}
+	return CardLoad{}, errors.Join(failures...)
+}
+
+func envOr(key, fallback string) string {
+	if value := strings.TrimSpace(os.Getenv(key)); value != "" {
+		return value
+	}
+	return fallback
+}
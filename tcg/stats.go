@@ -1,9 +1,181 @@
 package tcg
 
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
 type Stats struct {
-	TotalBattles   int            `json:"totalBattles"`
-	Wins           int            `json:"wins"`
-	Losses         int            `json:"losses"`
-	WinPercentage  float64        `json:"winPercentage"`
-	LossByOpponent map[string]int `json:"lossByOpponent"`
+	TotalBattles   int                               `json:"totalBattles"`
+	Wins           int                               `json:"wins"`
+	Losses         int                               `json:"losses"`
+	Ties           int                               `json:"ties"`
+	WinPercentage  float64                           `json:"winPercentage"`
+	WinRate        WinRateEstimate                   `json:"winRate"`
+	TieHandling    TieHandling                       `json:"tieHandling"`
+	Reasons        map[Outcome]map[OutcomeReason]int `json:"reasons,omitempty"`
+	LossByOpponent map[string]int                    `json:"lossByOpponent"`
+	TimeZone       string                            `json:"timeZone"`
+	Daily          []DayStats                        `json:"daily,omitempty"`
+	// Matchups covers opponents with at least MatchupMinGames games, most
+	// played first; HiddenMatchups counts the opponents left out.
+	Matchups        []Matchup `json:"matchups"`
+	MatchupMinGames int       `json:"matchupMinGames"`
+	HiddenMatchups  int       `json:"hiddenMatchups"`
+	// Query is the filter the stats were computed with, if any.
+	Query *StatsQuery `json:"query,omitempty"`
+}
+
+// Matchup is the record against one opponent archetype.
+type Matchup struct {
+	Opponent      string          `json:"opponent"`
+	Games         int             `json:"games"`
+	Wins          int             `json:"wins"`
+	Losses        int             `json:"losses"`
+	Ties          int             `json:"ties"`
+	WinPercentage float64         `json:"winPercentage"`
+	WinRate       WinRateEstimate `json:"winRate"`
+}
+
+// DayStats counts the games played on one calendar day in the stats' time
+// zone. Date uses the YYYY-MM-DD form.
+type DayStats struct {
+	Date   string `json:"date"`
+	Wins   int    `json:"wins"`
+	Losses int    `json:"losses"`
+	Ties   int    `json:"ties"`
+}
+
+// TieHandling decides how ties count towards the win percentage.
+type TieHandling string
+
+const (
+	// TiesExcluded leaves ties out of the denominator: wins / (wins + losses).
+	TiesExcluded TieHandling = "exclude"
+	// TiesAsHalf counts a tie as half a win out of every game played.
+	TiesAsHalf TieHandling = "half"
+	// TiesAsLosses counts ties in the denominator only: wins / all games.
+	TiesAsLosses TieHandling = "loss"
+)
+
+// ParseTieHandling accepts exclude, half or loss. An empty value means
+// TiesExcluded.
+func ParseTieHandling(value string) (TieHandling, error) {
+	switch handling := TieHandling(normalizeKey(value)); handling {
+	case "":
+		return TiesExcluded, nil
+	case TiesExcluded, TiesAsHalf, TiesAsLosses:
+		return handling, nil
+	}
+	return "", fmt.Errorf("invalid tie handling %q (use exclude, half or loss)", value)
+}
+
+// DefaultMatchupMinGames is how many games an opponent needs before its
+// matchup is listed, unless TCG_MATCHUP_MIN_GAMES says otherwise.
+const DefaultMatchupMinGames = 3
+
+// StatsOptions controls how battles are aggregated. Location is the zone
+// games are bucketed into days in; nil means the local zone.
+// MinMatchupGames below 1 lists every matchup. Win rates out of fewer than
+// SmallSampleGames games are flagged, and Posterior adds a Bayesian estimate
+// next to the Wilson interval.
+type StatsOptions struct {
+	Ties             TieHandling
+	Location         *time.Location
+	MinMatchupGames  int
+	SmallSampleGames int
+	Posterior        bool
+}
+
+// DefaultStatsOptions reads TCG_TIE_HANDLING, falling back to excluding ties
+// from the win percentage, and TCG_MATCHUP_MIN_GAMES, and buckets days in
+// DisplayTimeZone.
+func DefaultStatsOptions() StatsOptions {
+	handling, err := ParseTieHandling(strings.TrimSpace(os.Getenv("TCG_TIE_HANDLING")))
+	if err != nil {
+		handling = TiesExcluded
+	}
+	minGames := DefaultMatchupMinGames
+	if value, err := strconv.Atoi(strings.TrimSpace(os.Getenv("TCG_MATCHUP_MIN_GAMES"))); err == nil && value >= 0 {
+		minGames = value
+	}
+	sampleGames := DefaultSmallSampleGames
+	if value, err := strconv.Atoi(strings.TrimSpace(os.Getenv("TCG_SMALL_SAMPLE_GAMES"))); err == nil && value >= 0 {
+		sampleGames = value
+	}
+	posterior, _ := strconv.ParseBool(strings.TrimSpace(os.Getenv("TCG_WIN_RATE_POSTERIOR")))
+	return StatsOptions{
+		Ties:             handling,
+		Location:         DisplayTimeZone(),
+		MinMatchupGames:  minGames,
+		SmallSampleGames: sampleGames,
+		Posterior:        posterior,
+	}
+}
+
+// score returns the wins a rate is computed from and the games it is out of,
+// after tie handling.
+func (o StatsOptions) score(wins, losses, ties int) (float64, int) {
+	score, games := float64(wins), wins+losses
+	switch o.Ties {
+	case TiesAsHalf:
+		score += float64(ties) / 2
+		games += ties
+	case TiesAsLosses:
+		games += ties
+	}
+	return score, games
+}
+
+func (o StatsOptions) winPercentage(wins, losses, ties int) float64 {
+	score, games := o.score(wins, losses, ties)
+	if games == 0 {
+		return 0
+	}
+	return score / float64(games) * 100
+}
+
+func (o StatsOptions) estimate(wins, losses, ties int) WinRateEstimate {
+	score, games := o.score(wins, losses, ties)
+	low, high := wilsonInterval(score, games)
+	estimate := WinRateEstimate{
+		Rate:        o.winPercentage(wins, losses, ties),
+		Low:         low * 100,
+		High:        high * 100,
+		Games:       games,
+		SmallSample: games < o.SmallSampleGames,
+	}
+	if o.Posterior {
+		estimate.Posterior = betaPosterior(score, games)
+	}
+	return estimate
+}
+
+// matchups turns per-opponent tallies into the sorted matchup list, dropping
+// opponents with fewer than minGames games. It returns how many were dropped.
+func (o StatsOptions) matchups(byOpponent map[string]*Matchup) ([]Matchup, int) {
+	minGames := max(o.MinMatchupGames, 1)
+	matchups := []Matchup{}
+	hidden := 0
+	for _, matchup := range byOpponent {
+		matchup.Games = matchup.Wins + matchup.Losses + matchup.Ties
+		if matchup.Games < minGames {
+			hidden++
+			continue
+		}
+		matchup.WinPercentage = o.winPercentage(matchup.Wins, matchup.Losses, matchup.Ties)
+		matchup.WinRate = o.estimate(matchup.Wins, matchup.Losses, matchup.Ties)
+		matchups = append(matchups, *matchup)
+	}
+	sort.Slice(matchups, func(i, j int) bool {
+		if matchups[i].Games != matchups[j].Games {
+			return matchups[i].Games > matchups[j].Games
+		}
+		return strings.ToLower(matchups[i].Opponent) < strings.ToLower(matchups[j].Opponent)
+	})
+	return matchups, hidden
 }
@@ -1,8 +1,61 @@
 package tcg
 
-import "time"
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
 
 // Now returns the current time. It is defined for easier mocking in bindings or tests.
 func Now() time.Time {
 	return time.Now()
 }
+
+// legacyBattleLayouts are the zone-less layouts battle dates were stored in
+// before deck schema version 3.
+var legacyBattleLayouts = []string{"2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"}
+
+// LegacyTimeZone is the zone assumed for battle dates recorded without one.
+// TCG_LEGACY_TIME_ZONE takes an IANA name such as "Europe/Paris"; the default
+// is the local zone.
+func LegacyTimeZone() (*time.Location, error) {
+	return timeZoneFromEnv("TCG_LEGACY_TIME_ZONE")
+}
+
+// DisplayTimeZone is the zone stats are bucketed and dates shown in, from
+// TCG_TIME_ZONE, falling back to the local zone.
+func DisplayTimeZone() *time.Location {
+	location, err := timeZoneFromEnv("TCG_TIME_ZONE")
+	if err != nil {
+		return time.Local
+	}
+	return location
+}
+
+func timeZoneFromEnv(key string) (*time.Location, error) {
+	name := strings.TrimSpace(os.Getenv(key))
+	if name == "" {
+		return time.Local, nil
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", key, err)
+	}
+	return location, nil
+}
+
+// parseBattleDate reads a stored battle date: RFC 3339, or one of the legacy
+// layouts interpreted in location.
+func parseBattleDate(value string, location *time.Location) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if date, err := time.Parse(time.RFC3339, value); err == nil {
+		return date, nil
+	}
+	for _, layout := range legacyBattleLayouts {
+		if date, err := time.ParseInLocation(layout, value, location); err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized battle date %q", value)
+}
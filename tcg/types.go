@@ -1,24 +1,70 @@
 package tcg
 
+import "time"
+
 type Card struct {
-	Name string `json:"name"`
-	Set  string `json:"set"`
-	ID   string `json:"id"`
+	Name        string            `json:"name"`
+	Names       map[string]string `json:"names,omitempty"`
+	Set         string            `json:"set"`
+	SetCode     string            `json:"set_code,omitempty"`
+	ID          string            `json:"id"`
+	Rarity      string            `json:"rarity,omitempty"`
+	Packs       []string          `json:"packs,omitempty"`
+	Type        CardType          `json:"type,omitempty"`
+	Element     EnergyType        `json:"element,omitempty"`
+	HP          int               `json:"hp,omitempty"`
+	Stage       Stage             `json:"stage,omitempty"`
+	EvolvesFrom string            `json:"evolves_from,omitempty"`
+	Attacks     []Attack          `json:"attacks,omitempty"`
+	RetreatCost int               `json:"retreat_cost,omitempty"`
+	Weakness    EnergyType        `json:"weakness,omitempty"`
+	Ex          bool              `json:"ex,omitempty"`
+}
+
+type Attack struct {
+	Name   string       `json:"name"`
+	Cost   []EnergyType `json:"cost,omitempty"`
+	Damage string       `json:"damage,omitempty"`
+	Effect string       `json:"effect,omitempty"`
 }
 
+type CardType string
+
+type Stage string
+
+type EnergyType string
+
 type CardEntry struct {
+	ID    string `json:"id,omitempty"`
 	Name  string `json:"name"`
 	Set   string `json:"set"`
 	Count int    `json:"count"`
 }
 
+// BattleRecord is one game played with a deck. Opponent is the opponent's
+// deck archetype; everything after Result is optional.
 type BattleRecord struct {
-	Date     string `json:"date"`
-	Result   string `json:"result"`
-	Opponent string `json:"opponent"`
+	ID             string        `json:"id"`
+	Date           time.Time     `json:"date"`
+	Result         Outcome       `json:"result"`
+	Reason         OutcomeReason `json:"reason,omitempty"`
+	Opponent       string        `json:"opponent"`
+	OpponentPlayer string        `json:"opponent_player,omitempty"`
+	TurnOrder      TurnOrder     `json:"turn_order,omitempty"`
+	Points         int           `json:"points,omitempty"`
+	OpponentPoints int           `json:"opponent_points,omitempty"`
+	Turns          int           `json:"turns,omitempty"`
+	Format         string        `json:"format,omitempty"`
+	Mode           GameMode      `json:"mode,omitempty"`
+	Notes          string        `json:"notes,omitempty"`
+	Tags           []string      `json:"tags,omitempty"`
 }
 
 type deckFileData struct {
+	SchemaVersion int            `json:"schema_version"`
+	Name          string         `json:"name,omitempty"`
+	Format        string         `json:"format,omitempty"`
+	EnergyTypes   []EnergyType   `json:"energy_types,omitempty"`
 	Cards         []CardEntry    `json:"cards"`
 	BattleHistory []BattleRecord `json:"battle_history"`
 }
@@ -33,6 +79,7 @@ type AddCardResult struct {
 	Added       bool
 	TotalCopies int
 	SetCopies   int
+	Limit       int
 }
 
 const (
@@ -42,7 +89,35 @@ const (
 )
 
 const (
-	CardsSourceRemote CardsSource = "remote"
-	CardsSourceLocal  CardsSource = "local"
-	CardsSourceNone   CardsSource = "none"
+	CardsSourceRemote   CardsSource = "remote"
+	CardsSourceCache    CardsSource = "cache"
+	CardsSourceLocal    CardsSource = "local"
+	CardsSourceEmbedded CardsSource = "embedded"
+	CardsSourceNone     CardsSource = "none"
+)
+
+const (
+	CardTypePokemon   CardType = "pokemon"
+	CardTypeItem      CardType = "item"
+	CardTypeSupporter CardType = "supporter"
+	CardTypeTool      CardType = "tool"
+)
+
+const (
+	StageBasic Stage = "basic"
+	StageOne   Stage = "stage1"
+	StageTwo   Stage = "stage2"
+)
+
+const (
+	EnergyGrass     EnergyType = "grass"
+	EnergyFire      EnergyType = "fire"
+	EnergyWater     EnergyType = "water"
+	EnergyLightning EnergyType = "lightning"
+	EnergyPsychic   EnergyType = "psychic"
+	EnergyFighting  EnergyType = "fighting"
+	EnergyDarkness  EnergyType = "darkness"
+	EnergyMetal     EnergyType = "metal"
+	EnergyDragon    EnergyType = "dragon"
+	EnergyColorless EnergyType = "colorless"
 )
@@ -0,0 +1,177 @@
+package tcg
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	// DeckSize is the exact number of cards in a legal Pocket deck.
+	DeckSize = 20
+	// MaxCopies is how many cards with the same name a deck may hold.
+	MaxCopies = 2
+	// MaxEnergyTypes is how many types a deck's Energy Zone can generate.
+	MaxEnergyTypes = 3
+)
+
+type IssueSeverity string
+
+const (
+	IssueError   IssueSeverity = "error"
+	IssueWarning IssueSeverity = "warning"
+)
+
+// ValidationIssue is one problem found by Deck.Validate. Code is stable for
+// programs; Message is meant for people.
+type ValidationIssue struct {
+	Severity IssueSeverity `json:"severity"`
+	Code     string        `json:"code"`
+	Message  string        `json:"message"`
+	CardIDs  []string      `json:"card_ids,omitempty"`
+}
+
+type DeckValidation struct {
+	Legal  bool              `json:"legal"`
+	Issues []ValidationIssue `json:"issues"`
+}
+
+// Errors and Warnings split the issues by severity.
+func (v DeckValidation) Errors() []ValidationIssue {
+	return v.withSeverity(IssueError)
+}
+
+func (v DeckValidation) Warnings() []ValidationIssue {
+	return v.withSeverity(IssueWarning)
+}
+
+func (v DeckValidation) withSeverity(severity IssueSeverity) []ValidationIssue {
+	var issues []ValidationIssue
+	for _, issue := range v.Issues {
+		if issue.Severity == severity {
+			issues = append(issues, issue)
+		}
+	}
+	return issues
+}
+
+// Validate checks the deck against its format's deck building rules. Errors make
+// the deck illegal; warnings point at lists that are legal but unlikely to
+// play well, or that could not be fully checked.
+func (d *Deck) Validate() DeckValidation {
+	validation := DeckValidation{Issues: []ValidationIssue{}}
+	add := func(severity IssueSeverity, code, message string, cardIDs ...string) {
+		validation.Issues = append(validation.Issues, ValidationIssue{
+			Severity: severity,
+			Code:     code,
+			Message:  message,
+			CardIDs:  cardIDs,
+		})
+	}
+
+	format := d.ActiveFormat()
+	if d.Format != "" && !strings.EqualFold(format.Name, d.Format) {
+		add(IssueWarning, "unknown_format", fmt.Sprintf("Format %q is not available; checked against %s instead.", d.Format, format.Name))
+	}
+
+	total := 0
+	copies := make(map[string]int)
+	names := make(map[string]string)
+	limits := make(map[string]int)
+	var cards []Card
+	var unknown []string
+	for _, entry := range d.Cards {
+		total += entry.Count
+		name := d.entryName(entry)
+		key := strings.ToLower(name)
+		copies[key] += entry.Count
+		names[key] = name
+		if _, ok := limits[key]; !ok {
+			limits[key] = format.CopyLimit
+		}
+
+		card, ok := d.Catalog.lookupID(entry.ID)
+		if !ok {
+			unknown = append(unknown, entry.Name)
+			continue
+		}
+		cards = append(cards, card)
+		limits[key] = min(limits[key], format.Limit(card))
+		if reason := format.disallowed(card); reason != "" {
+			add(IssueError, "not_allowed", reason+".", card.ID)
+		}
+	}
+
+	if total != format.DeckSize {
+		add(IssueError, "deck_size", fmt.Sprintf("Deck has %d cards; it needs exactly %d.", total, format.DeckSize))
+	}
+
+	for _, key := range sortedKeys(copies) {
+		if copies[key] > limits[key] {
+			add(IssueError, "copy_limit", fmt.Sprintf("%d copies of %s; at most %d are allowed.", copies[key], names[key], limits[key]))
+		}
+	}
+
+	if len(unknown) > 0 {
+		add(IssueWarning, "unknown_cards", fmt.Sprintf("Not in the card database, so not checked: %s.", strings.Join(unknown, ", ")))
+	}
+
+	if d.Catalog.HasMetadata() {
+		d.validateBasics(cards, add)
+		d.validateEvolutions(cards, add)
+		d.validateEnergy(cards, add)
+	} else {
+		add(IssueWarning, "metadata_unavailable", "Card metadata is unavailable, so Basic Pokémon, evolution and Energy Zone checks were skipped; the card data in use has no stage, type or attack information.")
+	}
+
+	validation.Legal = len(validation.Errors()) == 0
+	return validation
+}
+
+func (d *Deck) validateBasics(cards []Card, add func(IssueSeverity, string, string, ...string)) {
+	missingStage := false
+	for _, card := range cards {
+		if card.IsBasicPokemon() {
+			return
+		}
+		if card.Type == "" || (card.IsPokemon() && card.Stage == "") {
+			missingStage = true
+		}
+	}
+	if missingStage {
+		add(IssueWarning, "no_basic", "Could not confirm a Basic Pokémon; the card data has no stage for some cards.")
+		return
+	}
+	add(IssueError, "no_basic", "Deck needs at least one Basic Pokémon.")
+}
+
+// validateEvolutions warns about Stage 1 and Stage 2 Pokémon whose previous
+// stage is not in the deck. Rare Candy can skip Stage 1, so this is a warning.
+func (d *Deck) validateEvolutions(cards []Card, add func(IssueSeverity, string, string, ...string)) {
+	inDeck := make(map[string]bool)
+	for _, card := range cards {
+		inDeck[strings.ToLower(card.Name)] = true
+	}
+
+	reported := make(map[string]bool)
+	for _, card := range cards {
+		if !card.IsPokemon() || card.Stage == StageBasic || card.EvolvesFrom == "" {
+			continue
+		}
+		from := strings.ToLower(card.EvolvesFrom)
+		if inDeck[from] || reported[strings.ToLower(card.Name)] {
+			continue
+		}
+		reported[strings.ToLower(card.Name)] = true
+		add(IssueWarning, "missing_evolution", fmt.Sprintf("%s evolves from %s, which is not in the deck.", card.Name, card.EvolvesFrom), card.ID)
+	}
+}
+
+func sortedKeys(values map[string]int) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,85 @@
+package tcg
+
+import "testing"
+
+func embeddedCatalog(t *testing.T) *Catalog {
+	t.Helper()
+	catalog, err := LoadCatalogFrom(SnapshotSource())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return catalog
+}
+
+func issueCodes(validation DeckValidation) map[string]IssueSeverity {
+	codes := make(map[string]IssueSeverity)
+	for _, issue := range validation.Issues {
+		codes[issue.Code] = issue.Severity
+	}
+	return codes
+}
+
+func TestValidateNoBasicWithEmbeddedCatalog(t *testing.T) {
+	catalog := embeddedCatalog(t)
+	deck := &Deck{Catalog: catalog}
+	for _, card := range catalog.Cards() {
+		if !card.IsBasicPokemon() {
+			deck.Cards = append(deck.Cards, CardEntry{ID: card.ID, Name: card.Name, Set: card.Set, Count: 2})
+		}
+		if len(deck.Cards) == 10 {
+			break
+		}
+	}
+
+	codes := issueCodes(deck.Validate())
+	if !catalog.HasMetadata() {
+		// Without stage data the check cannot run; it must say so once
+		// instead of guessing.
+		if _, ok := codes["metadata_unavailable"]; !ok {
+			t.Errorf("issues %v: want metadata_unavailable", codes)
+		}
+		if _, ok := codes["no_basic"]; ok {
+			t.Errorf("issues %v: no_basic reported without stage data", codes)
+		}
+		return
+	}
+	if codes["no_basic"] != IssueError {
+		t.Errorf("issues %v: want a no_basic error", codes)
+	}
+}
+
+func TestValidateEnergyWithEmbeddedCatalog(t *testing.T) {
+	catalog := embeddedCatalog(t)
+	deck := &Deck{Catalog: catalog}
+	var needs EnergyType
+	for _, card := range catalog.Cards() {
+		for _, attack := range card.Attacks {
+			for _, cost := range attack.Cost {
+				if needs == "" && isZoneEnergy(cost) {
+					needs = cost
+					deck.Cards = []CardEntry{{ID: card.ID, Name: card.Name, Set: card.Set, Count: 1}}
+				}
+			}
+		}
+	}
+	for _, energy := range zoneEnergyOrder {
+		if energy != needs {
+			deck.EnergyTypes = []EnergyType{energy}
+			break
+		}
+	}
+
+	codes := issueCodes(deck.Validate())
+	if !catalog.HasMetadata() {
+		if _, ok := codes["metadata_unavailable"]; !ok {
+			t.Errorf("issues %v: want metadata_unavailable", codes)
+		}
+		return
+	}
+	if needs == "" {
+		t.Fatal("no card in the embedded catalog has a typed attack cost")
+	}
+	if _, ok := codes["unpayable_attack"]; !ok {
+		t.Errorf("issues %v: want unpayable_attack for a %s cost with %v declared", codes, needs, deck.EnergyTypes)
+	}
+}